@@ -2,43 +2,142 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"ffwd-ui/ffmpeg"
+	"ffwd-ui/history"
+	"ffwd-ui/jobs"
 	"ffwd-ui/models"
+	"ffwd-ui/presets"
 	"ffwd-ui/system"
 
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
 type App struct {
-	ctx      context.Context
-	executor *ffmpeg.Executor
+	ctx     context.Context
+	queue   *jobs.Queue
+	presets *presets.Store
+	history *history.Store
+	emit    func(name string, data interface{})
+
+	batchMu         sync.Mutex
+	skipped         map[string][]models.BatchItem // batch ID -> files left out
+	finishedBatches map[string]bool
 }
 
 func NewApp() *App {
-	return &App{}
+	return &App{
+		skipped:         make(map[string][]models.BatchItem),
+		finishedBatches: make(map[string]bool),
+	}
 }
 
 func (a *App) startup(ctx context.Context) {
+	emit := func(name string, data interface{}) {
+		runtime.EventsEmit(ctx, name, data)
+	}
+
+	toolchain, err := locateToolchain()
+	if err != nil {
+		runtime.LogWarningf(ctx, "startup: could not load settings: %v", err)
+	}
+	for _, warning := range toolchain.Warnings {
+		runtime.LogWarningf(ctx, "startup: %s", warning)
+	}
+
+	if err := a.start(ctx, emit, "queue.json"); err != nil {
+		runtime.LogWarningf(ctx, "startup: %v", err)
+	}
+}
+
+// locateToolchain points the ffmpeg package at the binaries chosen in the
+// settings, or found without them. The toolchain is located even when the
+// settings cannot be read.
+func locateToolchain() (models.Toolchain, error) {
+	settings, err := system.LoadSettings()
+	return ffmpeg.LocateToolchain(settings.FFmpegPath, settings.FFprobePath), err
+}
+
+// start wires the job queue to emit, resumes any jobs saved in stateFile in
+// the config directory and loads the user's stores. It is shared by the
+// desktop app and the headless API server, which cannot use the Wails
+// runtime for events. Stores that fail to load start empty and the errors
+// are returned together.
+func (a *App) start(ctx context.Context, emit func(name string, data interface{}), stateFile string) error {
 	a.ctx = ctx
-	a.executor = ffmpeg.NewExecutor(ctx)
+	a.emit = emit
+
+	configDir, _ := system.ConfigDir()
+	configPath := func(name string) string {
+		if configDir == "" {
+			return ""
+		}
+		return filepath.Join(configDir, name)
+	}
+
+	var errs []error
+
+	store, err := presets.NewStore(configPath("presets.json"))
+	a.presets = store
+	if err != nil {
+		errs = append(errs, fmt.Errorf("could not load presets: %w", err))
+	}
+
+	historyStore, err := history.NewStore(configPath("history.jsonl"))
+	a.history = historyStore
+	if err != nil {
+		errs = append(errs, fmt.Errorf("could not load history: %w", err))
+	}
 
-	a.executor.SetProgressCallback(func(percent float64, message string) {
-		runtime.EventsEmit(ctx, "ffmpeg:progress", models.ProgressUpdate{
-			Percent: percent,
-			Message: message,
-		})
+	a.queue = jobs.NewQueue(ctx, configPath(stateFile))
+
+	a.queue.SetStartCallback(func(job models.Job) {
+		a.emit("job:start", job)
+		a.emitBatch(job)
+	})
+
+	a.queue.SetProgressCallback(func(update models.ProgressUpdate) {
+		a.emit("job:progress", update)
+		if job, ok := a.queue.Job(update.JobID); ok {
+			a.emitBatch(job)
+		}
+	})
+
+	a.queue.SetCompleteCallback(func(job models.Job) {
+		a.recordHistory(job)
+		a.emit("job:complete", job)
+		a.emitBatch(job)
 	})
 
-	a.executor.SetCompleteCallback(func() {
-		runtime.EventsEmit(ctx, "ffmpeg:complete", true)
+	a.queue.SetErrorCallback(func(job models.Job) {
+		a.recordHistory(job)
+		a.emit("job:error", job)
+		a.emitBatch(job)
 	})
 
-	a.executor.SetErrorCallback(func(err error) {
-		runtime.EventsEmit(ctx, "ffmpeg:error", err.Error())
+	a.queue.SetDiskCallback(func(alert models.DiskAlert) {
+		a.emit("job:disk", alert)
 	})
+
+	settings, err := system.LoadSettings()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("could not load settings: %w", err))
+	}
+	if err := a.queue.SetDiskPolicy(diskPolicy(settings)); err != nil {
+		errs = append(errs, fmt.Errorf("ignoring the disk settings: %w", err))
+	}
+	a.queue.SetPassTimeout(passTimeout(settings))
+
+	if err := a.queue.Load(); err != nil {
+		errs = append(errs, fmt.Errorf("could not restore job queue: %w", err))
+	}
+
+	return errors.Join(errs...)
 }
 
 func (a *App) SelectInputFile() (string, error) {
@@ -78,260 +177,443 @@ func (a *App) GetFileInfo(path string) (*models.FileInfo, error) {
 	return ffmpeg.ProbeFile(path)
 }
 
+// GetKeyframes returns the keyframe times of the main video stream of path
+// in seconds, the points where a copy trim can cut cleanly.
+func (a *App) GetKeyframes(path string) ([]float64, error) {
+	info, err := ffmpeg.ProbeFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ffmpeg.ProbeKeyframes(info, 0, 0)
+}
+
 func (a *App) ExtractThumbnail(inputPath string) (string, error) {
 	return ffmpeg.ExtractThumbnail(inputPath)
 }
 
-func (a *App) TrimStart(input, output string, seconds float64) error {
-	if a.executor.IsRunning() {
-		return fmt.Errorf("operation already running")
-	}
+func (a *App) TrimStart(input, output string, seconds float64, mode string) (string, error) {
+	return a.enqueue("trim_start", input, output, map[string]interface{}{
+		"seconds": seconds,
+		"mode":    mode,
+	})
+}
+
+func (a *App) TrimToLength(input, output string, duration float64, mode string) (string, error) {
+	return a.enqueue("trim_length", input, output, map[string]interface{}{
+		"duration": duration,
+		"mode":     mode,
+	})
+}
 
-	args := ffmpeg.BuildTrimStartCommand(input, output, seconds)
+func (a *App) ExtractAudio(input, output, format string) (string, error) {
+	return a.enqueue("extract_audio", input, output, map[string]interface{}{
+		"format": format,
+	})
+}
 
-	fileInfo, err := ffmpeg.ProbeFile(input)
-	if err != nil {
-		return err
-	}
+// CancelOperation cancels every queued and running job.
+func (a *App) CancelOperation() error {
+	a.queue.CancelAll()
+	return nil
+}
+
+func (a *App) CancelJob(id string) error {
+	return a.queue.Cancel(id)
+}
 
-	return a.executor.Execute(args, fileInfo.Duration)
+func (a *App) ListJobs() []models.Job {
+	return a.queue.Jobs()
 }
 
-func (a *App) TrimToLength(input, output string, duration float64) error {
-	if a.executor.IsRunning() {
-		return fmt.Errorf("operation already running")
+func (a *App) GetJob(id string) (models.Job, error) {
+	job, ok := a.queue.Job(id)
+	if !ok {
+		return models.Job{}, fmt.Errorf("%w: %s", jobs.ErrJobNotFound, id)
 	}
+	return job, nil
+}
 
-	args := ffmpeg.BuildTrimToLengthCommand(input, output, duration)
+func (a *App) ClearFinishedJobs() {
+	a.queue.ClearFinished()
+}
 
-	fileInfo, err := ffmpeg.ProbeFile(input)
-	if err != nil {
-		return err
-	}
+func (a *App) GetMaxConcurrentJobs() int {
+	return a.queue.Concurrency()
+}
 
-	return a.executor.Execute(args, fileInfo.Duration)
+func (a *App) SetMaxConcurrentJobs(n int) error {
+	return a.queue.SetConcurrency(n)
 }
 
-func (a *App) ExtractAudio(input, output, format string) error {
-	if a.executor.IsRunning() {
-		return fmt.Errorf("operation already running")
-	}
+func (a *App) ConvertFormat(input, output string) (string, error) {
+	return a.enqueue("convert_format", input, output, nil)
+}
 
-	args := ffmpeg.BuildExtractAudioCommand(input, output, format)
+// Transcode re-encodes input with the given codecs and quality settings,
+// after checking that the output container can hold them.
+func (a *App) Transcode(input, output string, settings models.TranscodeSettings) (string, error) {
+	return a.enqueue("transcode", input, output, map[string]interface{}{
+		"video_codec":   settings.VideoCodec,
+		"crf":           settings.CRF,
+		"preset":        settings.Preset,
+		"tune":          settings.Tune,
+		"pix_fmt":       settings.PixelFormat,
+		"audio_codec":   settings.AudioCodec,
+		"audio_bitrate": settings.AudioBitrate,
+	})
+}
 
-	fileInfo, err := ffmpeg.ProbeFile(input)
-	if err != nil {
-		return err
+// FitToSize encodes input in two passes at the bitrate that fits
+// targetSizeMB, and encodes it again at a lower bitrate if the result
+// still comes out too large.
+func (a *App) FitToSize(input, output string, targetSizeMB float64, videoCodec string) (string, error) {
+	params := map[string]interface{}{
+		"target_size": targetSizeMB,
+	}
+	if videoCodec != "" {
+		params["video_codec"] = videoCodec
 	}
+	return a.enqueue("target_size", input, output, params)
+}
 
-	return a.executor.Execute(args, fileInfo.Duration)
+func (a *App) ChangeResolution(input, output string, width, height int, hwAccel string) (string, error) {
+	return a.enqueue("change_resolution", input, output, map[string]interface{}{
+		"width":    width,
+		"height":   height,
+		"hw_accel": hwAccel,
+	})
 }
 
-func (a *App) CancelOperation() error {
-	return a.executor.Cancel()
+func (a *App) AdjustVolume(input, output string, volumePercent int) (string, error) {
+	return a.enqueue("adjust_volume", input, output, map[string]interface{}{
+		"volume_percent": volumePercent,
+	})
 }
 
-func (a *App) ConvertFormat(input, output string) error {
-	if a.executor.IsRunning() {
-		return fmt.Errorf("operation already running")
-	}
+func (a *App) TrimRange(input, output string, startSeconds, endSeconds float64, mode string) (string, error) {
+	return a.enqueue("trim_range", input, output, map[string]interface{}{
+		"start_seconds": startSeconds,
+		"end_seconds":   endSeconds,
+		"mode":          mode,
+	})
+}
 
-	args := ffmpeg.BuildConvertFormatCommand(input, output)
+func (a *App) CropVideo(input, output string, width, height, x, y int) (string, error) {
+	return a.enqueue("crop_video", input, output, map[string]interface{}{
+		"width":  width,
+		"height": height,
+		"x":      x,
+		"y":      y,
+	})
+}
 
-	fileInfo, err := ffmpeg.ProbeFile(input)
-	if err != nil {
-		return err
-	}
+func (a *App) AdjustBitrate(input, output, videoBitrate, audioBitrate, hwAccel string, twoPass bool) (string, error) {
+	return a.enqueue("adjust_bitrate", input, output, map[string]interface{}{
+		"video_bitrate": videoBitrate,
+		"audio_bitrate": audioBitrate,
+		"hw_accel":      hwAccel,
+		"two_pass":      twoPass,
+	})
+}
 
-	return a.executor.Execute(args, fileInfo.Duration)
+func (a *App) AddPadding(input, output string, startSeconds, endSeconds float64) (string, error) {
+	return a.enqueue("add_padding", input, output, map[string]interface{}{
+		"start_seconds": startSeconds,
+		"end_seconds":   endSeconds,
+	})
 }
 
-func (a *App) ChangeResolution(input, output string, width, height int, hwAccel string) error {
-	if a.executor.IsRunning() {
-		return fmt.Errorf("operation already running")
-	}
+// SelectStreams copies the chosen streams of input in the given order,
+// setting their dispositions and tags. Stream indexes are those reported by
+// GetFileInfo.
+func (a *App) SelectStreams(input, output string, streams []models.StreamSelection) (string, error) {
+	return a.enqueue("select_streams", input, output, map[string]interface{}{
+		"streams": streams,
+	})
+}
 
-	args := ffmpeg.BuildChangeResolutionCommand(input, output, width, height, hwAccel)
+// EditMetadata rewrites the container tags and chapters of input without
+// re-encoding. Empty tags are left unchanged, and the existing chapters are
+// kept unless chapters is non-empty or clearChapters is set.
+func (a *App) EditMetadata(input, output, title, artist, comment, date string, chapters []models.Chapter, clearChapters bool) (string, error) {
+	return a.enqueue("edit_metadata", input, output, map[string]interface{}{
+		"title":          title,
+		"artist":         artist,
+		"comment":        comment,
+		"date":           date,
+		"chapters":       chapters,
+		"clear_chapters": clearChapters,
+	})
+}
 
-	fileInfo, err := ffmpeg.ProbeFile(input)
-	if err != nil {
-		return err
+// JoinFiles appends the other inputs to the first one in order. With mode
+// "auto" the files are copied when their codecs and parameters match and
+// re-encoded to the first file's size and sample rate otherwise.
+func (a *App) JoinFiles(inputs []string, output, mode string) (string, error) {
+	if len(inputs) < 2 {
+		return "", fmt.Errorf("select at least two files to join")
 	}
+	if mode == "" {
+		mode = "auto"
+	}
+	return a.enqueue("concat", inputs[0], output, map[string]interface{}{
+		"inputs": inputs[1:],
+		"mode":   mode,
+	})
+}
 
-	return a.executor.Execute(args, fileInfo.Duration)
+func (a *App) DetectHardwareEncoder() string {
+	return ffmpeg.DetectHardwareEncoder()
 }
 
-func (a *App) AdjustVolume(input, output string, volumePercent int) error {
-	if a.executor.IsRunning() {
-		return fmt.Errorf("operation already running")
+// GetHardwareEncoders returns the hardware encoders that passed a test
+// encode. The result is cached; refresh probes them again.
+func (a *App) GetHardwareEncoders(refresh bool) []models.HardwareEncoder {
+	if refresh {
+		return ffmpeg.RefreshHardwareEncoders()
 	}
+	return ffmpeg.HardwareEncoders()
+}
 
-	args := ffmpeg.BuildAdjustVolumeCommand(input, output, volumePercent)
+// GetToolchain returns the ffmpeg and ffprobe in use, the libraries ffmpeg
+// was built with and warnings about operations it cannot run.
+func (a *App) GetToolchain() models.Toolchain {
+	return ffmpeg.CurrentToolchain()
+}
 
-	fileInfo, err := ffmpeg.ProbeFile(input)
-	if err != nil {
-		return err
+func (a *App) GetSettings() (models.Settings, error) {
+	return system.LoadSettings()
+}
+
+// SaveSettings stores settings, applies the disk policy to the running
+// jobs and locates the toolchain again. The overwrite policy applies to
+// the next request and the pass timeout to the next job started.
+func (a *App) SaveSettings(settings models.Settings) (models.Toolchain, error) {
+	switch settings.DiskAction {
+	case "", jobs.DiskPause, jobs.DiskCancel:
+	default:
+		return ffmpeg.CurrentToolchain(), fmt.Errorf("disk_action must be %s or %s", jobs.DiskPause, jobs.DiskCancel)
+	}
+	if err := validOverwrite(settings.Overwrite); err != nil {
+		return ffmpeg.CurrentToolchain(), err
+	}
+	if err := checkDiskSettings(settings); err != nil {
+		return ffmpeg.CurrentToolchain(), err
+	}
+	if settings.PassTimeoutMinutes < 0 {
+		return ffmpeg.CurrentToolchain(), fmt.Errorf("pass_timeout_minutes cannot be negative")
 	}
 
-	return a.executor.Execute(args, fileInfo.Duration)
+	if err := system.SaveSettings(settings); err != nil {
+		return ffmpeg.CurrentToolchain(), err
+	}
+	if err := a.queue.SetDiskPolicy(diskPolicy(settings)); err != nil {
+		return ffmpeg.CurrentToolchain(), err
+	}
+	a.queue.SetPassTimeout(passTimeout(settings))
+	return ffmpeg.LocateToolchain(settings.FFmpegPath, settings.FFprobePath), nil
 }
 
-func (a *App) TrimRange(input, output string, startSeconds, endSeconds float64) error {
-	if a.executor.IsRunning() {
-		return fmt.Errorf("operation already running")
+// passTimeout returns the limit on each ffmpeg invocation in settings, or
+// ffmpeg.DefaultPassTimeout when they leave it unset.
+func passTimeout(settings models.Settings) time.Duration {
+	if settings.PassTimeoutMinutes <= 0 {
+		return ffmpeg.DefaultPassTimeout
 	}
+	return time.Duration(settings.PassTimeoutMinutes) * time.Minute
+}
 
-	args := ffmpeg.BuildTrimRangeCommand(input, output, startSeconds, endSeconds)
+func (a *App) GetDiskSpace() ([]models.MountPoint, error) {
+	return system.GetAllMountPoints()
+}
 
-	fileInfo, err := ffmpeg.ProbeFile(input)
+// GetOperations returns the registered operations and their parameter
+// schemas so the frontend can render a form for each.
+func (a *App) GetOperations() []*ffmpeg.Operation {
+	return ffmpeg.Operations()
+}
+
+func (a *App) PreviewCommand(operation string, input, output string, params map[string]interface{}) (string, error) {
+	passes, err := previewPasses(operation, input, output, params)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	return a.executor.Execute(args, fileInfo.Duration)
+	return ffmpeg.BuildPassesString(passes), nil
 }
 
-func (a *App) CropVideo(input, output string, width, height, x, y int) error {
-	if a.executor.IsRunning() {
-		return fmt.Errorf("operation already running")
+// ValidateOperation checks params against the operation and, when input
+// is given, against the probed input, and returns the problems for the
+// frontend to show next to each field. Problems with no field, such as an
+// input without video, have an empty Field. It returns nil when the
+// parameters are acceptable.
+func (a *App) ValidateOperation(operation, input string, params map[string]interface{}) []models.FieldError {
+	op, err := ffmpeg.LookupOperation(operation)
+	if err != nil {
+		return ffmpeg.FieldErrors(err)
 	}
 
-	args := ffmpeg.BuildCropVideoCommand(input, output, width, height, x, y)
+	resolved, err := op.Resolve(params)
+	if err != nil {
+		return ffmpeg.FieldErrors(err)
+	}
+	if input == "" || op.CheckInput == nil {
+		return nil
+	}
 
-	fileInfo, err := ffmpeg.ProbeFile(input)
+	fileInfo, err := ffmpeg.ProbeFile(ffmpeg.SafePath(input))
 	if err != nil {
-		return err
+		return []models.FieldError{{Field: "input", Message: err.Error()}}
 	}
+	if err := op.CheckInput(resolved, fileInfo); err != nil {
+		return ffmpeg.FieldErrors(err)
+	}
+	return nil
+}
+
+func (a *App) GetDefaultOutputName(inputPath, operation string) string {
+	op, err := ffmpeg.LookupOperation(operation)
+	if err != nil {
+		ext := filepath.Ext(inputPath)
+		return inputPath[:len(inputPath)-len(ext)] + "_output" + ext
+	}
+	return op.OutputName(inputPath)
+}
+
+// RunOperation queues any registered operation and returns the job ID.
+func (a *App) RunOperation(operation, input, output string, params map[string]interface{}) (string, error) {
+	return a.enqueue(operation, input, output, params)
+}
+
+// PreviewPipeline returns the ffmpeg commands that RunPipeline would run.
+func (a *App) PreviewPipeline(input, output string, steps []models.PipelineStep) (string, error) {
+	return a.PreviewCommand("pipeline", input, output, map[string]interface{}{
+		"steps": steps,
+	})
+}
+
+// RunPipeline queues steps as a single job, each step working on the
+// previous step's output, and returns the job ID.
+func (a *App) RunPipeline(input, output string, steps []models.PipelineStep) (string, error) {
+	return a.enqueue("pipeline", input, output, map[string]interface{}{
+		"steps": steps,
+	})
+}
 
-	return a.executor.Execute(args, fileInfo.Duration)
+// enqueue queues an operation with the overwrite policy in the settings.
+func (a *App) enqueue(operation, input, output string, params map[string]interface{}) (string, error) {
+	return a.enqueueWithOverwrite(operation, input, output, params, "")
 }
 
-func (a *App) AdjustBitrate(input, output, videoBitrate, audioBitrate, hwAccel string, twoPass bool) error {
-	if a.executor.IsRunning() {
-		return fmt.Errorf("operation already running")
+// enqueueWithOverwrite applies the overwrite policy to the output, builds
+// the command for a registered operation, probes the input for its
+// duration, checks that the output fits on its disk and adds the job to the
+// queue, returning the new job's ID.
+func (a *App) enqueueWithOverwrite(operation, input, output string, params map[string]interface{}, overwrite string) (string, error) {
+	policy, err := overwritePolicy(overwrite)
+	if err != nil {
+		return "", err
+	}
+	output, err = a.resolveOutput(output, policy, a.outputTaken(nil))
+	if err != nil {
+		return "", err
 	}
 
-	args := ffmpeg.BuildAdjustBitrateCommand(input, output, videoBitrate, audioBitrate, hwAccel, twoPass)
+	task, err := prepareTask(operation, input, output, params)
+	if err != nil {
+		return "", err
+	}
 
-	fileInfo, err := ffmpeg.ProbeFile(input)
+	tasks := []jobs.Task{task}
+	if err := a.reserveSpace(tasks); err != nil {
+		return "", err
+	}
+
+	job, err := a.queue.Enqueue(tasks[0])
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	return a.executor.Execute(args, fileInfo.Duration)
+	return job.ID, nil
 }
 
-func (a *App) AddPadding(input, output string, startSeconds, endSeconds float64) error {
-	if a.executor.IsRunning() {
-		return fmt.Errorf("operation already running")
+// prepareTask resolves a registered operation into the ffmpeg passes for
+// input and the output duration of each, which needs the input probed. The
+// paths are checked first, and the task keeps them in the form the passes
+// use.
+func prepareTask(operation, input, output string, params map[string]interface{}) (jobs.Task, error) {
+	op, err := ffmpeg.LookupOperation(operation)
+	if err != nil {
+		return jobs.Task{}, err
 	}
 
-	args := ffmpeg.BuildAddPaddingCommand(input, output, startSeconds, endSeconds)
+	resolved, err := op.Resolve(params)
+	if err != nil {
+		return jobs.Task{}, err
+	}
 
-	fileInfo, err := ffmpeg.ProbeFile(input)
+	input, output, err = op.CheckPaths(input, output, resolved)
 	if err != nil {
-		return err
+		return jobs.Task{}, err
 	}
 
-	return a.executor.Execute(args, fileInfo.Duration)
-}
+	fileInfo, err := ffmpeg.ProbeFile(input)
+	if err != nil {
+		return jobs.Task{}, err
+	}
+	duration, err := op.Prepare(resolved, fileInfo, output)
+	if err != nil {
+		return jobs.Task{}, err
+	}
 
-func (a *App) DetectHardwareEncoder() string {
-	return ffmpeg.DetectHardwareEncoder()
+	passes := op.Build(input, output, resolved)
+	if err := ffmpeg.CheckPasses(passes); err != nil {
+		return jobs.Task{}, fmt.Errorf("%s: %w", op.Name, err)
+	}
+	return jobs.Task{
+		Operation: models.OperationParams{
+			Operation: operation,
+			Input:     input,
+			Output:    output,
+			Params:    resolved,
+		},
+		Passes:     passes,
+		Files:      op.WorkFiles(input, resolved),
+		Durations:  op.PassDurations(resolved, duration, len(passes)),
+		OutputSize: op.EstimateSize(resolved, fileInfo, duration),
+	}, nil
 }
 
-func (a *App) GetDiskSpace() ([]models.MountPoint, error) {
-	return system.GetAllMountPoints()
-}
+// previewPasses builds the command for an operation without queueing it.
+// Operations with a Plan are prepared against the input when it can be
+// probed, so the preview shows the command that would run. The paths are
+// only made safe for ffmpeg here; the other checks of CheckPaths wait until
+// the job is queued.
+func previewPasses(operation, input, output string, params map[string]interface{}) ([][]string, error) {
+	op, err := ffmpeg.LookupOperation(operation)
+	if err != nil {
+		return nil, err
+	}
 
-func (a *App) PreviewCommand(operation string, input, output string, params map[string]interface{}) (string, error) {
-	var args []string
+	resolved, err := op.Resolve(params)
+	if err != nil {
+		return nil, err
+	}
+	input, output = ffmpeg.SafePath(input), ffmpeg.SafePath(output)
 
-	switch operation {
-	case "trim_start":
-		if seconds, ok := params["seconds"].(float64); ok {
-			args = ffmpeg.BuildTrimStartCommand(input, output, seconds)
-		}
-	case "trim_length":
-		if duration, ok := params["duration"].(float64); ok {
-			args = ffmpeg.BuildTrimToLengthCommand(input, output, duration)
-		}
-	case "extract_audio":
-		if format, ok := params["format"].(string); ok {
-			args = ffmpeg.BuildExtractAudioCommand(input, output, format)
-		}
-	case "convert_format":
-		args = ffmpeg.BuildConvertFormatCommand(input, output)
-	case "change_resolution":
-		width := int(params["width"].(float64))
-		height := int(params["height"].(float64))
-		hwAccel := ""
-		if hw, ok := params["hw_accel"].(string); ok {
-			hwAccel = hw
+	if op.Plan != nil {
+		if fileInfo, err := ffmpeg.ProbeFile(input); err == nil {
+			if _, err := op.Prepare(resolved, fileInfo, output); err != nil {
+				return nil, err
+			}
 		}
-		args = ffmpeg.BuildChangeResolutionCommand(input, output, width, height, hwAccel)
-	case "adjust_volume":
-		volumePercent := int(params["volume_percent"].(float64))
-		args = ffmpeg.BuildAdjustVolumeCommand(input, output, volumePercent)
-	case "trim_range":
-		startSeconds := params["start_seconds"].(float64)
-		endSeconds := params["end_seconds"].(float64)
-		args = ffmpeg.BuildTrimRangeCommand(input, output, startSeconds, endSeconds)
-	case "crop_video":
-		width := int(params["width"].(float64))
-		height := int(params["height"].(float64))
-		x := int(params["x"].(float64))
-		y := int(params["y"].(float64))
-		args = ffmpeg.BuildCropVideoCommand(input, output, width, height, x, y)
-	case "adjust_bitrate":
-		videoBitrate := params["video_bitrate"].(string)
-		audioBitrate := params["audio_bitrate"].(string)
-		hwAccel := ""
-		twoPass := false
-		if hw, ok := params["hw_accel"].(string); ok {
-			hwAccel = hw
-		}
-		if tp, ok := params["two_pass"].(bool); ok {
-			twoPass = tp
-		}
-		args = ffmpeg.BuildAdjustBitrateCommand(input, output, videoBitrate, audioBitrate, hwAccel, twoPass)
-	case "add_padding":
-		startSeconds := params["start_seconds"].(float64)
-		endSeconds := params["end_seconds"].(float64)
-		args = ffmpeg.BuildAddPaddingCommand(input, output, startSeconds, endSeconds)
-	default:
-		return "", fmt.Errorf("unknown operation: %s", operation)
 	}
 
-	return ffmpeg.BuildCommandString(args), nil
+	return op.Build(input, output, resolved), nil
 }
 
-func (a *App) GetDefaultOutputName(inputPath, operation string) string {
-	ext := filepath.Ext(inputPath)
-	base := inputPath[:len(inputPath)-len(ext)]
-
-	switch operation {
-	case "trim_start":
-		return base + "_trimmed" + ext
-	case "trim_length":
-		return base + "_cut" + ext
-	case "trim_range":
-		return base + "_trimmed" + ext
-	case "extract_audio":
-		return base + "_audio.mp3"
-	case "convert_format":
-		return base + "_converted" + ext
-	case "change_resolution":
-		return base + "_resized" + ext
-	case "adjust_volume":
-		return base + "_volume" + ext
-	case "crop_video":
-		return base + "_cropped" + ext
-	case "adjust_bitrate":
-		return base + "_bitrate" + ext
-	case "add_padding":
-		return base + "_padded" + ext
-	default:
-		return base + "_output" + ext
+func (a *App) recordHistory(job models.Job) {
+	if err := a.history.Record(job); err != nil {
+		a.emit("history:error", err.Error())
 	}
 }
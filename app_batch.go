@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ffwd-ui/ffmpeg"
+	"ffwd-ui/jobs"
+	"ffwd-ui/models"
+)
+
+// defaultNameTemplate names batch outputs the way GetDefaultOutputName
+// does for a single file.
+const defaultNameTemplate = "{default}"
+
+// RunBatch queues req.Operation once per input file and returns the batch
+// summary. Progress is reported per file through the job events and for
+// the whole batch as "batch:progress", followed by "batch:complete" with
+// the final summary.
+//
+// Some files cannot be prepared, for example because ffprobe cannot read
+// them, or because their output exists and req.Overwrite is to ask. With
+// req.StopOnError set, such a file fails the whole request. Otherwise it
+// is left out and listed in the summary as failed.
+func (a *App) RunBatch(req models.BatchRequest) (models.BatchSummary, error) {
+	op, err := ffmpeg.LookupOperation(req.Operation)
+	if err != nil {
+		return models.BatchSummary{}, err
+	}
+
+	inputs, err := batchInputs(req)
+	if err != nil {
+		return models.BatchSummary{}, err
+	}
+
+	policy, err := overwritePolicy(req.Overwrite)
+	if err != nil {
+		return models.BatchSummary{}, err
+	}
+
+	template := req.NameTemplate
+	if template == "" {
+		template = defaultNameTemplate
+	}
+
+	var tasks []jobs.Task
+	var skipped []models.BatchItem
+	outputs := make(map[string]string, len(inputs))
+	assigned := make(map[string]bool, len(inputs))
+
+	for i, input := range inputs {
+		output, err := batchOutputName(op, template, input, req.OutputDir, i+1)
+		if err != nil {
+			return models.BatchSummary{}, err
+		}
+		if other, exists := outputs[output]; exists {
+			return models.BatchSummary{}, fmt.Errorf("%s and %s would both be written to %s", other, input, output)
+		}
+		outputs[output] = input
+
+		var task jobs.Task
+		output, err = a.resolveOutput(output, policy, a.outputTaken(assigned))
+		if err == nil {
+			assigned[outputKey(output)] = true
+			task, err = prepareTask(req.Operation, input, output, req.Params)
+		}
+		if err != nil {
+			if req.StopOnError {
+				return models.BatchSummary{}, fmt.Errorf("%s: %w", input, err)
+			}
+			skipped = append(skipped, models.BatchItem{
+				Input:  input,
+				Output: output,
+				Status: models.JobFailed,
+				Error:  err.Error(),
+			})
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+
+	tasks, skipped, err = a.reserveBatchSpace(tasks, skipped, req.StopOnError)
+	if err != nil {
+		return models.BatchSummary{}, err
+	}
+
+	if len(tasks) == 0 {
+		return models.BatchSummary{}, fmt.Errorf("none of the %d files could be processed: %s", len(inputs), skipped[0].Error)
+	}
+
+	id, err := a.queue.EnqueueBatch(tasks, req.StopOnError)
+	if err != nil {
+		return models.BatchSummary{}, err
+	}
+
+	a.batchMu.Lock()
+	a.skipped[id] = skipped
+	a.batchMu.Unlock()
+
+	return a.GetBatch(id)
+}
+
+// reserveBatchSpace checks that the outputs of tasks fit on their disks
+// together with the jobs already queued. Outputs that do not fit fail the
+// batch with stopOnError and are otherwise moved to skipped; those that
+// barely fit get a warning.
+func (a *App) reserveBatchSpace(tasks []jobs.Task, skipped []models.BatchItem, stopOnError bool) ([]jobs.Task, []models.BatchItem, error) {
+	checks, err := spaceChecks(tasks, a.queue.Jobs(), a.queue.DiskPolicy())
+	if err != nil {
+		return tasks, skipped, nil
+	}
+
+	var kept []jobs.Task
+	for i, check := range checks {
+		task := tasks[i]
+		if !check.Fits {
+			if stopOnError {
+				return nil, nil, fmt.Errorf("not enough disk space: %s", check.Warning)
+			}
+			skipped = append(skipped, models.BatchItem{
+				Input:  task.Operation.Input,
+				Output: task.Operation.Output,
+				Status: models.JobFailed,
+				Error:  "not enough disk space: " + check.Warning,
+			})
+			continue
+		}
+		if check.Warning != "" {
+			task.Warnings = append(task.Warnings, check.Warning)
+		}
+		kept = append(kept, task)
+	}
+	return kept, skipped, nil
+}
+
+// GetBatch returns the current summary of a batch started with RunBatch.
+func (a *App) GetBatch(id string) (models.BatchSummary, error) {
+	summary, err := a.queue.Batch(id)
+	if err != nil {
+		return summary, err
+	}
+
+	a.batchMu.Lock()
+	skipped := a.skipped[id]
+	a.batchMu.Unlock()
+
+	if len(skipped) > 0 {
+		finished := float64(summary.Total) * summary.Percent / 100
+		summary.Items = append(summary.Items, skipped...)
+		summary.Failed += len(skipped)
+		summary.Total += len(skipped)
+		summary.Percent = (finished + float64(len(skipped))) * 100 / float64(summary.Total)
+	}
+	return summary, nil
+}
+
+// emitBatch reports the progress of job's batch, and the final summary the
+// first time every job in it has finished.
+func (a *App) emitBatch(job models.Job) {
+	if job.Batch == nil {
+		return
+	}
+
+	summary, err := a.GetBatch(job.Batch.ID)
+	if err != nil {
+		return
+	}
+	a.emit("batch:progress", summary)
+
+	if !summary.Done {
+		return
+	}
+
+	a.batchMu.Lock()
+	reported := a.finishedBatches[summary.ID]
+	a.finishedBatches[summary.ID] = true
+	a.batchMu.Unlock()
+
+	if !reported {
+		a.emit("batch:complete", summary)
+	}
+}
+
+// batchInputs returns the files named by req, in a stable order.
+func batchInputs(req models.BatchRequest) ([]string, error) {
+	if len(req.Inputs) > 0 {
+		return req.Inputs, nil
+	}
+	if req.Directory == "" {
+		return nil, fmt.Errorf("select input files or a directory")
+	}
+
+	pattern := req.Pattern
+	if pattern == "" {
+		pattern = "*"
+	}
+
+	matches, err := filepath.Glob(filepath.Join(req.Directory, pattern))
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	var inputs []string
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && info.Mode().IsRegular() {
+			inputs = append(inputs, match)
+		}
+	}
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("no files in %s match %s", req.Directory, pattern)
+	}
+
+	sort.Strings(inputs)
+	return inputs, nil
+}
+
+// batchOutputName expands template for one input. The result is a file name
+// placed in outputDir, or next to the input when outputDir is empty.
+func batchOutputName(op *ffmpeg.Operation, template, input, outputDir string, index int) (string, error) {
+	defaultName := filepath.Base(op.OutputName(input))
+	ext := filepath.Ext(defaultName)
+	base := filepath.Base(input)
+
+	name := strings.NewReplacer(
+		"{default}", defaultName,
+		"{name}", strings.TrimSuffix(base, filepath.Ext(base)),
+		"{ext}", ext,
+		"{index}", strconv.Itoa(index),
+	).Replace(template)
+
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("name template %q must produce a file name", template)
+	}
+	if filepath.Ext(name) == "" {
+		name += ext
+	}
+
+	dir := outputDir
+	if dir == "" {
+		dir = filepath.Dir(input)
+	}
+	return filepath.Join(dir, name), nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+
+	"ffwd-ui/ffmpeg"
+	"ffwd-ui/jobs"
+	"ffwd-ui/models"
+	"ffwd-ui/system"
+)
+
+// diskSpaceMargin is how much more free space than the estimate an output
+// should leave before it is warned about, since estimates of encodes are
+// rough.
+const diskSpaceMargin = 0.25
+
+// CheckDiskSpace estimates the size of an operation's output and compares
+// it with the free space left where it will be written once the queued and
+// running jobs there have finished.
+func (a *App) CheckDiskSpace(operation, input, output string, params map[string]interface{}) (models.SpaceCheck, error) {
+	task, err := prepareTask(operation, input, output, params)
+	if err != nil {
+		return models.SpaceCheck{}, err
+	}
+
+	checks, err := spaceChecks([]jobs.Task{task}, a.queue.Jobs(), a.queue.DiskPolicy())
+	if err != nil {
+		return models.SpaceCheck{}, err
+	}
+	return checks[0], nil
+}
+
+// reserveSpace refuses the first of tasks whose output does not fit on its
+// mount and adds a warning to those that barely fit. When the free space
+// cannot be read, the tasks are let through unchecked.
+func (a *App) reserveSpace(tasks []jobs.Task) error {
+	checks, err := spaceChecks(tasks, a.queue.Jobs(), a.queue.DiskPolicy())
+	if err != nil {
+		return nil
+	}
+
+	for i, check := range checks {
+		if !check.Fits {
+			return fmt.Errorf("not enough disk space: %s", check.Warning)
+		}
+		if check.Warning != "" {
+			tasks[i].Warnings = append(tasks[i].Warnings, check.Warning)
+		}
+	}
+	return nil
+}
+
+// spaceChecks compares the estimated output of each task with the free
+// space of the mount it is written to, less what the pending jobs and the
+// earlier tasks that fit will write there and the StopBelow bytes at which
+// the disk watchdog of policy would stop them. Outputs on no known mount
+// are assumed to fit. Warning explains a check that does not fit or fits
+// with little to spare.
+func spaceChecks(tasks []jobs.Task, pending []models.Job, policy jobs.DiskPolicy) ([]models.SpaceCheck, error) {
+	mounts, err := system.GetAllMountPoints()
+	if err != nil {
+		return nil, err
+	}
+
+	reserved := make(map[string]int64)
+	for _, job := range pending {
+		if job.Status != models.JobQueued && job.Status != models.JobRunning {
+			continue
+		}
+		if mount, ok := system.MountFor(job.Operation.Output, mounts); ok {
+			reserved[mount.Path] += peakSize(job.Operation.Operation, job.OutputSize)
+		}
+	}
+
+	checks := make([]models.SpaceCheck, len(tasks))
+	for i, task := range tasks {
+		check := models.SpaceCheck{
+			Output:    task.Operation.Output,
+			Estimated: task.OutputSize,
+			Fits:      true,
+		}
+
+		if mount, ok := system.MountFor(task.Operation.Output, mounts); ok {
+			check.Mount = mount.Path
+			check.Available = mount.Available
+			check.Pending = reserved[mount.Path]
+
+			usable := float64(mount.Available) - float64(policy.StopBelow)
+			peak := peakSize(task.Operation.Operation, task.OutputSize)
+			needed := float64(check.Pending + peak)
+			check.Fits = needed <= usable
+			if check.Fits {
+				reserved[mount.Path] += peak
+			}
+			if !check.Fits || needed*(1+diskSpaceMargin) > usable {
+				check.Warning = spaceMessage(check, policy.StopBelow)
+			}
+		}
+		checks[i] = check
+	}
+	return checks, nil
+}
+
+// peakSize returns the most space a job of operation writing an output of
+// size bytes takes at once. The output is written to a partial file that
+// replaces it only at the end, so an existing output is not counted as
+// freed; an operation that retries writes the next attempt alongside the
+// previous one, and needs room for both.
+func peakSize(operation string, size int64) int64 {
+	if op, err := ffmpeg.LookupOperation(operation); err == nil && op.Retry != nil {
+		return 2 * size
+	}
+	return size
+}
+
+func spaceMessage(check models.SpaceCheck, keep uint64) string {
+	message := fmt.Sprintf("%s needs about %s and %s has %s free", check.Output, system.FormatBytes(check.Estimated), check.Mount, system.FormatBytes(int64(check.Available)))
+	if keep > 0 {
+		message += fmt.Sprintf(", %s of which is kept free to stop jobs before the disk fills", system.FormatBytes(int64(keep)))
+	}
+	if check.Pending > 0 {
+		message += fmt.Sprintf(", and queued jobs need about %s", system.FormatBytes(check.Pending))
+	}
+	return message
+}
+
+// checkDiskSettings reports the disk thresholds of settings that the
+// watchdog cannot use as errors of their fields. A threshold left at zero
+// is checked as its default.
+func checkDiskSettings(settings models.Settings) error {
+	var fields []models.FieldError
+	if settings.DiskWarnMB < 0 {
+		fields = append(fields, models.FieldError{Field: "disk_warn_mb", Message: "cannot be negative"})
+	}
+	if settings.DiskStopMB < 0 {
+		fields = append(fields, models.FieldError{Field: "disk_stop_mb", Message: "cannot be negative"})
+	}
+	if policy := diskPolicy(settings); len(fields) == 0 && policy.StopBelow >= policy.WarnBelow {
+		fields = append(fields, models.FieldError{Field: "disk_stop_mb", Message: fmt.Sprintf("must be less than the warning threshold of %d MB", policy.WarnBelow/(1000*1000))})
+	}
+	if len(fields) > 0 {
+		return &ffmpeg.ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// diskPolicy returns the watchdog policy of settings, with the defaults
+// for what they leave unset.
+func diskPolicy(settings models.Settings) jobs.DiskPolicy {
+	policy := jobs.DefaultDiskPolicy
+	if settings.DiskWarnMB > 0 {
+		policy.WarnBelow = uint64(settings.DiskWarnMB) * 1000 * 1000
+	}
+	if settings.DiskStopMB > 0 {
+		policy.StopBelow = uint64(settings.DiskStopMB) * 1000 * 1000
+	}
+	if settings.DiskAction != "" {
+		policy.Action = settings.DiskAction
+	}
+	return policy
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+
+	"ffwd-ui/history"
+	"ffwd-ui/models"
+)
+
+func (a *App) GetHistory(query models.HistoryQuery) []models.HistoryEntry {
+	return a.history.Query(query)
+}
+
+func (a *App) ClearHistory() error {
+	return a.history.Clear()
+}
+
+// RerunHistoryEntry queues the operation of a history entry again with the
+// same input, output and parameters, and returns the new job ID. The output
+// usually exists from the first run, so overwrite says what to do with it
+// as for RunOperationWithOverwrite.
+func (a *App) RerunHistoryEntry(id, overwrite string) (string, error) {
+	entry, err := a.history.Get(id)
+	if err != nil {
+		return "", err
+	}
+
+	op := entry.Operation
+	return a.enqueueWithOverwrite(op.Operation, op.Input, op.Output, op.Params, overwrite)
+}
+
+// GetHistoryScript returns the selected entries as a POSIX shell script.
+func (a *App) GetHistoryScript(ids []string) (string, error) {
+	entries, err := a.history.Select(ids)
+	if err != nil {
+		return "", err
+	}
+	return history.ShellScript(entries), nil
+}
+
+// ExportHistoryScript writes the selected entries to path as an executable
+// POSIX shell script.
+func (a *App) ExportHistoryScript(ids []string, path string) error {
+	script, err := a.GetHistoryScript(ids)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(script), 0o755)
+}
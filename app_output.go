@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"ffwd-ui/models"
+	"ffwd-ui/system"
+)
+
+// Policies for an output that already exists. With OverwriteAsk the request
+// is refused with ErrOutputExists so that the user can be asked and the
+// request repeated with one of the others. OverwriteRename writes to the
+// first free name with a numbered suffix, such as clip_1.mp4.
+const (
+	OverwriteAsk    = "ask"
+	OverwriteAlways = "overwrite"
+	OverwriteRename = "rename"
+)
+
+// ErrOutputExists is returned when an output is taken and the overwrite
+// policy is to ask.
+var ErrOutputExists = errors.New("output already exists")
+
+// CheckOutput reports whether output already exists or is written by a
+// queued or running job, and the name OverwriteRename would use instead.
+func (a *App) CheckOutput(output string) models.OutputCheck {
+	check := models.OutputCheck{Output: output, Exists: fileExists(output)}
+	check.JobID = a.pendingOutputs()[outputKey(output)]
+
+	taken := a.outputTaken(nil)
+	check.Suggested = output
+	if taken(output) {
+		check.Suggested = freeOutputName(output, taken)
+	}
+	return check
+}
+
+// RunOperationWithOverwrite queues an operation like RunOperation with an
+// explicit overwrite policy for its output: ask, overwrite or rename. An
+// empty policy uses the one in the settings.
+func (a *App) RunOperationWithOverwrite(operation, input, output string, params map[string]interface{}, overwrite string) (string, error) {
+	return a.enqueueWithOverwrite(operation, input, output, params, overwrite)
+}
+
+// overwritePolicy returns overwrite when it is set and otherwise the policy
+// in the settings, OverwriteAsk by default.
+func overwritePolicy(overwrite string) (string, error) {
+	if overwrite == "" {
+		settings, err := system.LoadSettings()
+		if err != nil {
+			return "", err
+		}
+		overwrite = settings.Overwrite
+	}
+	if overwrite == "" {
+		return OverwriteAsk, nil
+	}
+	if err := validOverwrite(overwrite); err != nil {
+		return "", err
+	}
+	return overwrite, nil
+}
+
+func validOverwrite(overwrite string) error {
+	switch overwrite {
+	case "", OverwriteAsk, OverwriteAlways, OverwriteRename:
+		return nil
+	}
+	return fmt.Errorf("overwrite must be %s, %s or %s", OverwriteAsk, OverwriteAlways, OverwriteRename)
+}
+
+// resolveOutput applies policy to output and returns the path to write.
+// taken reports whether a path exists or is written by another job. An
+// output that another job writes is never overwritten, since both would
+// end with a rename into place and one would silently be lost.
+func (a *App) resolveOutput(output, policy string, taken func(string) bool) (string, error) {
+	if !taken(output) {
+		return output, nil
+	}
+
+	switch policy {
+	case OverwriteRename:
+		return freeOutputName(output, taken), nil
+	case OverwriteAlways:
+		if id := a.pendingOutputs()[outputKey(output)]; id != "" {
+			return "", fmt.Errorf("%s is already being written by job %s", output, id)
+		}
+		return output, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrOutputExists, output)
+	}
+}
+
+// outputTaken returns the check for resolveOutput: a path is taken when the
+// file exists, when a queued or running job writes it, or when it is in
+// extra, the outputs already given to earlier files of a batch.
+func (a *App) outputTaken(extra map[string]bool) func(string) bool {
+	pending := a.pendingOutputs()
+	return func(path string) bool {
+		key := outputKey(path)
+		return pending[key] != "" || extra[key] || fileExists(path)
+	}
+}
+
+// pendingOutputs maps the outputs of the queued and running jobs to their
+// IDs.
+func (a *App) pendingOutputs() map[string]string {
+	outputs := make(map[string]string)
+	for _, job := range a.queue.Jobs() {
+		if job.Status == models.JobQueued || job.Status == models.JobRunning {
+			outputs[outputKey(job.Operation.Output)] = job.ID
+		}
+	}
+	return outputs
+}
+
+// freeOutputName returns the first of name_1.ext, name_2.ext, ... that is
+// not taken.
+func freeOutputName(output string, taken func(string) bool) string {
+	ext := filepath.Ext(output)
+	stem := strings.TrimSuffix(output, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s_%d%s", stem, i, ext)
+		if !taken(candidate) {
+			return candidate
+		}
+	}
+}
+
+// outputKey is the form in which outputs are compared, so that a relative
+// and an absolute path to the same file match.
+func outputKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"ffwd-ui/models"
+	"ffwd-ui/presets"
+)
+
+func (a *App) ListPresets() []models.Preset {
+	return a.presets.List()
+}
+
+// SavePreset stores the operation and parameters of op under name. The
+// input and output paths are not saved.
+func (a *App) SavePreset(name string, op models.OperationParams) (models.Preset, error) {
+	return a.presets.Save(name, op)
+}
+
+func (a *App) RenamePreset(oldName, newName string) error {
+	return a.presets.Rename(oldName, newName)
+}
+
+func (a *App) DeletePreset(name string) error {
+	return a.presets.Delete(name)
+}
+
+func (a *App) ImportPresets(path string) (int, error) {
+	return a.presets.Import(path)
+}
+
+// ExportPresets writes the named presets, or all of them when names is
+// empty, to path.
+func (a *App) ExportPresets(path string, names []string) error {
+	return a.presets.Export(path, names)
+}
+
+// ApplyPreset checks a preset against the current parameters of its
+// operation and returns it with defaults filled in, ready to load into the
+// form.
+func (a *App) ApplyPreset(name string) (models.OperationParams, error) {
+	preset, err := a.presets.Get(name)
+	if err != nil {
+		return models.OperationParams{}, err
+	}
+
+	params, err := presets.Validate(preset.Operation)
+	if err != nil {
+		return models.OperationParams{}, err
+	}
+
+	return models.OperationParams{
+		Operation: preset.Operation.Operation,
+		Params:    params,
+	}, nil
+}
+
+// RunPreset queues the preset's operation for input and returns the job ID.
+func (a *App) RunPreset(name, input, output string) (string, error) {
+	op, err := a.ApplyPreset(name)
+	if err != nil {
+		return "", err
+	}
+	return a.enqueue(op.Operation, input, output, op.Params)
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"ffwd-ui/ffmpeg"
+	"ffwd-ui/jobs"
+	"ffwd-ui/models"
+	"ffwd-ui/system"
+)
+
+// Exit codes returned by the command-line interface.
+const (
+	exitOK        = 0
+	exitFailed    = 1 // ffmpeg ran and failed
+	exitUsage     = 2 // bad command, flags or parameters
+	exitInput     = 3 // the input could not be probed
+	exitNoSpace   = 4 // the output would not fit on its disk
+	exitExists    = 5 // the output exists and was not overwritten
+	exitCancelled = 130
+)
+
+// isCLICommand reports whether args name a command-line subcommand, in which
+// case the app runs headless instead of opening a window.
+func isCLICommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	switch args[0] {
+	case "help", "-h", "-help", "--help", "probe", "operations", "hardware", "toolchain", "serve":
+		return true
+	}
+
+	_, err := ffmpeg.LookupOperation(operationName(args[0]))
+	return err == nil
+}
+
+// runCLI runs one subcommand and returns the process exit code.
+func runCLI(args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		printUsage(os.Stdout)
+		return exitOK
+	}
+
+	toolchain, err := locateToolchain()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: could not load settings:", err)
+	}
+
+	switch args[0] {
+	case "toolchain":
+		return runToolchainCommand(toolchain)
+	case "operations":
+		return runOperationsCommand()
+	case "hardware":
+		return runHardwareCommand()
+	case "probe":
+		return runProbeCommand(args[1:])
+	case "serve":
+		return runServeCommand(ctx, args[1:])
+	}
+
+	op, err := ffmpeg.LookupOperation(operationName(args[0]))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		printUsage(os.Stderr)
+		return exitUsage
+	}
+
+	return runOperationCommand(ctx, op, args[1:])
+}
+
+func runOperationCommand(ctx context.Context, op *ffmpeg.Operation, args []string) int {
+	flags := flag.NewFlagSet(commandName(op.Name), flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "print the ffmpeg command instead of running it")
+	quiet := flags.Bool("quiet", false, "do not print progress")
+	overwrite := flags.Bool("overwrite", false, "overwrite the output if it exists")
+	keep := flags.Bool("no-overwrite", false, "fail if the output exists")
+	rename := flags.Bool("rename", false, "write to a free numbered name if the output exists")
+
+	raw := make(map[string]interface{})
+	for _, spec := range op.Params {
+		value := &paramFlag{spec: spec, raw: raw}
+		usage := spec.Label
+		if len(spec.Options) > 0 {
+			usage += " (" + strings.Join(spec.Options, ", ") + ")"
+		}
+		if spec.Default != nil && spec.Default != "" {
+			usage += fmt.Sprintf(" (default %v)", spec.Default)
+		}
+
+		flags.Var(value, commandName(spec.Name), usage)
+		for _, alias := range spec.Aliases {
+			flags.Var(value, alias, "alias for -"+commandName(spec.Name))
+		}
+	}
+
+	// -y and -n are short for the overwrite flags, as in ffmpeg, unless the
+	// operation has parameters of that name, such as crop_video's y offset.
+	if flags.Lookup("y") == nil {
+		flags.BoolVar(overwrite, "y", false, "short for -overwrite")
+	}
+	if flags.Lookup("n") == nil {
+		flags.BoolVar(keep, "n", false, "short for -no-overwrite")
+	}
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: ffwd-ui %s [flags] <input> [output]\n\n%s\n\n", flags.Name(), op.Label)
+		flags.PrintDefaults()
+	}
+
+	// Flags may appear before or after the file arguments. Everything after
+	// "--" is a file, for names that start with a dash.
+	var files []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return exitOK
+			}
+			return exitUsage
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		if rest := len(args) - flags.NArg(); rest > 0 && args[rest-1] == "--" {
+			files = append(files, flags.Args()...)
+			break
+		}
+		files = append(files, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+
+	if len(files) < 1 || len(files) > 2 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	input := files[0]
+	output := op.OutputName(input)
+	if len(files) == 2 {
+		output = files[1]
+	}
+
+	params, err := op.Resolve(raw)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitUsage
+	}
+
+	if *dryRun {
+		passes, err := previewPasses(op.Name, input, output, raw)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return exitUsage
+		}
+		fmt.Println(ffmpeg.BuildPassesString(passes))
+		return exitOK
+	}
+
+	policy, err := cliOverwritePolicy(*overwrite, *keep, *rename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitUsage
+	}
+	output, err = cliOutput(output, policy)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitExists
+	}
+	input, output, err = op.CheckPaths(input, output, params)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitUsage
+	}
+
+	fileInfo, err := ffmpeg.ProbeFile(input)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitInput
+	}
+	duration, err := op.Prepare(params, fileInfo, output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitUsage
+	}
+	passes := op.Build(input, output, params)
+	if err := ffmpeg.CheckPasses(passes); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", op.Name, err)
+		return exitUsage
+	}
+
+	task := jobs.Task{
+		Operation:  models.OperationParams{Operation: op.Name, Input: input, Output: output},
+		OutputSize: op.EstimateSize(params, fileInfo, duration),
+	}
+	settings, _ := system.LoadSettings()
+	if checks, err := spaceChecks([]jobs.Task{task}, nil, diskPolicy(settings)); err == nil {
+		if !checks[0].Fits {
+			fmt.Fprintln(os.Stderr, "Error: not enough disk space:", checks[0].Warning)
+			return exitNoSpace
+		}
+		if checks[0].Warning != "" {
+			fmt.Fprintln(os.Stderr, "Warning:", checks[0].Warning)
+		}
+	}
+
+	done := make(chan error, 1)
+	executor := ffmpeg.NewExecutor(ctx)
+	executor.SetPassTimeout(passTimeout(settings))
+
+	if !*quiet {
+		executor.SetProgressCallback(func(update models.ProgressUpdate) {
+			printProgress(os.Stderr, update)
+		})
+	}
+	executor.SetCompleteCallback(func() {
+		done <- nil
+	})
+	executor.SetErrorCallback(func(err error) {
+		done <- err
+	})
+
+	executor.SetWorkFiles(op.WorkFiles(input, params))
+	executor.SetOutput(output)
+	if op.Retry != nil {
+		executor.SetVerify(func(attempt int) ([][]string, []float64, error) {
+			next, passes, err := op.RetryPasses(input, output, params, attempt)
+			params = next
+			return passes, op.PassDurations(params, duration, len(passes)), err
+		})
+	}
+	if op.Fallback != nil {
+		executor.SetFallback(func() ([][]string, []float64) {
+			next, passes := op.FallbackPasses(input, output, params)
+			params = next
+			return passes, op.PassDurations(params, duration, len(passes))
+		})
+	}
+	if err := executor.ExecutePasses(passes, op.PassDurations(params, duration, len(passes))); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailed
+	}
+
+	err = <-done
+	if !*quiet {
+		fmt.Fprintln(os.Stderr)
+	}
+
+	switch {
+	case err == nil:
+		fmt.Fprintln(os.Stderr, "Wrote", output)
+		return exitOK
+	case errors.Is(err, ffmpeg.ErrCancelled):
+		fmt.Fprintln(os.Stderr, "Cancelled")
+		return exitCancelled
+	default:
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailed
+	}
+}
+
+// cliOverwritePolicy returns the overwrite policy chosen with --overwrite,
+// --no-overwrite or --rename, or the one in the settings when none is
+// given.
+func cliOverwritePolicy(overwrite, keep, rename bool) (string, error) {
+	var policies []string
+	if overwrite {
+		policies = append(policies, OverwriteAlways)
+	}
+	if keep {
+		policies = append(policies, OverwriteAsk)
+	}
+	if rename {
+		policies = append(policies, OverwriteRename)
+	}
+
+	switch len(policies) {
+	case 0:
+		return overwritePolicy("")
+	case 1:
+		return policies[0], nil
+	}
+	return "", fmt.Errorf("--overwrite, --no-overwrite and --rename cannot be combined")
+}
+
+// cliOutput applies policy to an output that exists. Asking prompts on a
+// terminal and refuses otherwise, as -n does.
+func cliOutput(output, policy string) (string, error) {
+	if !fileExists(output) {
+		return output, nil
+	}
+
+	switch policy {
+	case OverwriteAlways:
+		return output, nil
+	case OverwriteRename:
+		renamed := freeOutputName(output, fileExists)
+		fmt.Fprintf(os.Stderr, "%s exists, writing to %s\n", output, renamed)
+		return renamed, nil
+	}
+
+	if stat, err := os.Stdin.Stat(); err == nil && stat.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprintf(os.Stderr, "%s already exists. Overwrite? [y/N] ", output)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return output, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s (use --overwrite to overwrite it or --rename to write next to it)", ErrOutputExists, output)
+}
+
+func runProbeCommand(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: ffwd-ui probe <input>")
+		return exitUsage
+	}
+
+	fileInfo, err := ffmpeg.ProbeFile(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitInput
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(fileInfo)
+	return exitOK
+}
+
+func runOperationsCommand() int {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(ffmpeg.Operations())
+	return exitOK
+}
+
+func runHardwareCommand() int {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(ffmpeg.HardwareEncoders())
+	return exitOK
+}
+
+func runToolchainCommand(toolchain models.Toolchain) int {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(toolchain)
+	return exitOK
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: ffwd-ui <command> [flags] <input> [output]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run without a command to start the desktop app.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, op := range ffmpeg.Operations() {
+		fmt.Fprintf(w, "  %-20s %s\n", commandName(op.Name), op.Label)
+	}
+	fmt.Fprintf(w, "  %-20s %s\n", "probe", "Print file information as JSON")
+	fmt.Fprintf(w, "  %-20s %s\n", "operations", "Print the operation schemas as JSON")
+	fmt.Fprintf(w, "  %-20s %s\n", "hardware", "Print the working hardware encoders as JSON")
+	fmt.Fprintf(w, "  %-20s %s\n", "toolchain", "Print the ffmpeg build in use as JSON")
+	fmt.Fprintf(w, "  %-20s %s\n", "serve", "Run the local HTTP API")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'ffwd-ui <command> -h' for the flags of a command.")
+}
+
+func printProgress(w io.Writer, update models.ProgressUpdate) {
+	const width = 30
+	filled := int(update.Percent / 100 * width)
+
+	line := fmt.Sprintf("\r[%s%s] %5.1f%%", strings.Repeat("=", filled), strings.Repeat(" ", width-filled), update.Percent)
+	if update.Speed > 0 {
+		line += fmt.Sprintf("  %.2fx", update.Speed)
+	}
+	if update.ETA > 0 {
+		eta := int(update.ETA)
+		line += fmt.Sprintf("  ETA %02d:%02d:%02d", eta/3600, eta/60%60, eta%60)
+	}
+	fmt.Fprint(w, line+"   ")
+}
+
+// commandName turns an operation or parameter name into its command-line
+// spelling, e.g. trim_range becomes trim-range.
+func commandName(name string) string {
+	return strings.ReplaceAll(name, "_", "-")
+}
+
+func operationName(command string) string {
+	return strings.ReplaceAll(command, "-", "_")
+}
+
+// paramFlag collects a flag value into raw under the parameter's name so
+// that only flags given on the command line override the defaults.
+type paramFlag struct {
+	spec ffmpeg.ParamSpec
+	raw  map[string]interface{}
+}
+
+func (f *paramFlag) String() string {
+	if f == nil || f.raw == nil {
+		return ""
+	}
+	if v, ok := f.raw[f.spec.Name]; ok {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+func (f *paramFlag) Set(value string) error {
+	f.raw[f.spec.Name] = value
+	return nil
+}
+
+func (f *paramFlag) IsBoolFlag() bool {
+	return f.spec.Type == ffmpeg.ParamBool
+}
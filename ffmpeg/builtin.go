@@ -0,0 +1,341 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"regexp"
+
+	"ffwd-ui/models"
+)
+
+// languageTag matches ISO 639 language codes, optionally followed by BCP 47
+// subtags as Matroska allows.
+var languageTag = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]+)*$`)
+
+func init() {
+	RegisterOperation(&Operation{
+		Name:  "trim_start",
+		Label: "Trim Start",
+		Params: []ParamSpec{
+			{Name: "seconds", Label: "Seconds to remove", Type: ParamNumber, Required: true, Min: floatPtr(0)},
+			trimModeParam,
+		},
+		OutputSuffix: "_trimmed",
+		CheckInput: func(p Params, info *models.FileInfo) error {
+			var errs fieldErrors
+			checkTrimStart(&errs, "seconds", p.Float("seconds"), info)
+			return errs.err()
+		},
+		Build: func(input, output string, p Params) [][]string {
+			if passes := buildTrim(input, output, p, p.Float("seconds"), 0); passes != nil {
+				return passes
+			}
+			return [][]string{BuildTrimStartCommand(input, output, trimCutStart(p, p.Float("seconds")))}
+		},
+		Durations: func(p Params, inputDuration float64) []float64 {
+			return trimDurations(p, p.Float("seconds"), 0, inputDuration)
+		},
+		Plan: func(p Params, info *models.FileInfo, output string) (float64, error) {
+			return planTrim(p, info, p.Float("seconds"), 0)
+		},
+		Files: trimFiles,
+		Chain: func(p Params) *ChainSegment {
+			return &ChainSegment{InputArgs: []string{"-ss", formatSeconds(p.Float("seconds"))}}
+		},
+	})
+
+	RegisterOperation(&Operation{
+		Name:  "trim_length",
+		Label: "Trim to Length",
+		Params: []ParamSpec{
+			{Name: "duration", Label: "Length (seconds)", Type: ParamNumber, Required: true, Min: floatPtr(0)},
+			trimModeParam,
+		},
+		OutputSuffix: "_cut",
+		Validate: func(p Params) error {
+			if p.Float("duration") <= 0 {
+				return fieldError("duration", fmt.Errorf("must be greater than zero"))
+			}
+			return nil
+		},
+		CheckInput: func(p Params, info *models.FileInfo) error {
+			var errs fieldErrors
+			checkTrimEnd(&errs, "duration", p.Float("duration"), info)
+			return errs.err()
+		},
+		Build: func(input, output string, p Params) [][]string {
+			if passes := buildTrim(input, output, p, 0, p.Float("duration")); passes != nil {
+				return passes
+			}
+			return [][]string{BuildTrimToLengthCommand(input, output, p.Float("duration"))}
+		},
+		Durations: func(p Params, inputDuration float64) []float64 {
+			return trimDurations(p, 0, p.Float("duration"), inputDuration)
+		},
+		Plan: func(p Params, info *models.FileInfo, output string) (float64, error) {
+			return planTrim(p, info, 0, p.Float("duration"))
+		},
+		Files: trimFiles,
+		Chain: func(p Params) *ChainSegment {
+			return &ChainSegment{InputArgs: []string{"-t", formatSeconds(p.Float("duration"))}}
+		},
+	})
+
+	RegisterOperation(&Operation{
+		Name:  "trim_range",
+		Label: "Trim Range",
+		Params: []ParamSpec{
+			{Name: "start_seconds", Label: "Start (seconds)", Type: ParamNumber, Required: true, Min: floatPtr(0), Aliases: []string{"start"}},
+			{Name: "end_seconds", Label: "End (seconds)", Type: ParamNumber, Required: true, Min: floatPtr(0), Aliases: []string{"end"}},
+			trimModeParam,
+		},
+		OutputSuffix: "_trimmed",
+		Validate: func(p Params) error {
+			if p.Float("end_seconds") <= p.Float("start_seconds") {
+				return fieldError("end_seconds", fmt.Errorf("must be after the start"))
+			}
+			return nil
+		},
+		CheckInput: func(p Params, info *models.FileInfo) error {
+			var errs fieldErrors
+			checkTrimStart(&errs, "start_seconds", p.Float("start_seconds"), info)
+			checkTrimEnd(&errs, "end_seconds", p.Float("end_seconds"), info)
+			return errs.err()
+		},
+		Build: func(input, output string, p Params) [][]string {
+			start, end := p.Float("start_seconds"), p.Float("end_seconds")
+			if passes := buildTrim(input, output, p, start, end); passes != nil {
+				return passes
+			}
+			return [][]string{BuildTrimRangeCommand(input, output, trimCutStart(p, start), end)}
+		},
+		Durations: func(p Params, inputDuration float64) []float64 {
+			return trimDurations(p, p.Float("start_seconds"), p.Float("end_seconds"), inputDuration)
+		},
+		Plan: func(p Params, info *models.FileInfo, output string) (float64, error) {
+			return planTrim(p, info, p.Float("start_seconds"), p.Float("end_seconds"))
+		},
+		Files: trimFiles,
+		Chain: func(p Params) *ChainSegment {
+			return &ChainSegment{InputArgs: []string{
+				"-ss", formatSeconds(p.Float("start_seconds")),
+				"-to", formatSeconds(p.Float("end_seconds")),
+			}}
+		},
+	})
+
+	RegisterOperation(&Operation{
+		Name:  "extract_audio",
+		Label: "Extract Audio",
+		Params: []ParamSpec{
+			{Name: "format", Label: "Format", Type: ParamString, Default: "mp3", Options: []string{"mp3", "aac", "wav", "flac"}},
+		},
+		OutputSuffix: "_audio",
+		OutputExt:    ".mp3",
+		Build: func(input, output string, p Params) [][]string {
+			return [][]string{BuildExtractAudioCommand(input, output, p.String("format"))}
+		},
+		Estimate: estimateAudio,
+	})
+
+	RegisterOperation(&Operation{
+		Name:         "convert_format",
+		Label:        "Convert Format",
+		OutputSuffix: "_converted",
+		Build: func(input, output string, p Params) [][]string {
+			return [][]string{BuildConvertFormatCommand(input, output)}
+		},
+		Plan: func(p Params, info *models.FileInfo, output string) (float64, error) {
+			if err := checkRemux(info, output); err != nil {
+				return 0, err
+			}
+			return info.Duration, nil
+		},
+	})
+
+	RegisterOperation(&Operation{
+		Name:  "change_resolution",
+		Label: "Change Resolution",
+		Params: []ParamSpec{
+			{Name: "width", Label: "Width", Type: ParamInt, Default: 1280, Min: floatPtr(0)},
+			{Name: "height", Label: "Height", Type: ParamInt, Default: 720, Min: floatPtr(0)},
+			{Name: "hw_accel", Label: "Hardware encoder", Type: ParamString, Default: "none"},
+		},
+		OutputSuffix: "_resized",
+		// A zero dimension keeps the aspect ratio, so only one may be zero.
+		Validate: func(p Params) error {
+			var errs fieldErrors
+			if p.Int("width") == 0 && p.Int("height") == 0 {
+				errs.add("width", "must be greater than zero when the height is zero")
+				errs.add("height", "must be greater than zero when the width is zero")
+			}
+			return errs.err()
+		},
+		CheckInput: checkResolution,
+		Build: func(input, output string, p Params) [][]string {
+			return [][]string{BuildChangeResolutionCommand(input, output, p.Int("width"), p.Int("height"), p.String("hw_accel"))}
+		},
+		Fallback: fallbackHWAccel,
+		Estimate: estimateResolution,
+		Chain: func(p Params) *ChainSegment {
+			if hw := p.String("hw_accel"); hw != "" && hw != "none" {
+				return nil
+			}
+			return &ChainSegment{VideoFilters: []string{scaleFilter(p.Int("width"), p.Int("height"))}}
+		},
+	})
+
+	RegisterOperation(&Operation{
+		Name:  "adjust_volume",
+		Label: "Adjust Volume",
+		Params: []ParamSpec{
+			{Name: "volume_percent", Label: "Volume (%)", Type: ParamInt, Default: 100, Min: floatPtr(0), Max: floatPtr(maxVolumePercent)},
+		},
+		OutputSuffix: "_volume",
+		CheckInput: func(p Params, info *models.FileInfo) error {
+			if firstAudioStream(info) == nil {
+				return fmt.Errorf("the input has no audio")
+			}
+			return nil
+		},
+		Build: func(input, output string, p Params) [][]string {
+			return [][]string{BuildAdjustVolumeCommand(input, output, p.Int("volume_percent"))}
+		},
+		Chain: func(p Params) *ChainSegment {
+			return &ChainSegment{AudioFilters: []string{volumeFilter(p.Int("volume_percent"))}}
+		},
+	})
+
+	RegisterOperation(&Operation{
+		Name:  "crop_video",
+		Label: "Crop Video",
+		Params: []ParamSpec{
+			{Name: "width", Label: "Width", Type: ParamInt, Required: true, Min: floatPtr(1)},
+			{Name: "height", Label: "Height", Type: ParamInt, Required: true, Min: floatPtr(1)},
+			{Name: "x", Label: "X offset", Type: ParamInt, Default: 0, Min: floatPtr(0)},
+			{Name: "y", Label: "Y offset", Type: ParamInt, Default: 0, Min: floatPtr(0)},
+		},
+		OutputSuffix: "_cropped",
+		CheckInput:   checkCrop,
+		Build: func(input, output string, p Params) [][]string {
+			return [][]string{BuildCropVideoCommand(input, output, p.Int("width"), p.Int("height"), p.Int("x"), p.Int("y"))}
+		},
+		Estimate: estimateCrop,
+		Chain: func(p Params) *ChainSegment {
+			return &ChainSegment{VideoFilters: []string{cropFilter(p.Int("width"), p.Int("height"), p.Int("x"), p.Int("y"))}}
+		},
+	})
+
+	RegisterOperation(&Operation{
+		Name:  "adjust_bitrate",
+		Label: "Adjust Bitrate",
+		Params: []ParamSpec{
+			{Name: "video_bitrate", Label: "Video bitrate", Type: ParamString, Default: ""},
+			{Name: "audio_bitrate", Label: "Audio bitrate", Type: ParamString, Default: ""},
+			{Name: "hw_accel", Label: "Hardware encoder", Type: ParamString, Default: "none"},
+			{Name: "two_pass", Label: "Two-pass encoding", Type: ParamBool, Default: false},
+		},
+		OutputSuffix: "_bitrate",
+		Validate: func(p Params) error {
+			return checkBitrates(p, "video_bitrate", "audio_bitrate").err()
+		},
+		Build: func(input, output string, p Params) [][]string {
+			return BuildAdjustBitrateCommand(input, output, p.String("video_bitrate"), p.String("audio_bitrate"), p.String("hw_accel"), p.Bool("two_pass"))
+		},
+		Fallback: fallbackHWAccel,
+		Estimate: estimateBitrate,
+	})
+
+	RegisterOperation(&Operation{
+		Name:  "add_padding",
+		Label: "Add Padding",
+		Params: []ParamSpec{
+			{Name: "start_seconds", Label: "Start padding (seconds)", Type: ParamNumber, Default: 0.0, Min: floatPtr(0), Aliases: []string{"start"}},
+			{Name: "end_seconds", Label: "End padding (seconds)", Type: ParamNumber, Default: 0.0, Min: floatPtr(0), Aliases: []string{"end"}},
+		},
+		OutputSuffix: "_padded",
+		Validate: func(p Params) error {
+			if p.Float("start_seconds") <= 0 && p.Float("end_seconds") <= 0 {
+				return fmt.Errorf("set a start or end padding")
+			}
+			return nil
+		},
+		Build: func(input, output string, p Params) [][]string {
+			return [][]string{BuildAddPaddingCommand(input, output, p.Float("start_seconds"), p.Float("end_seconds"))}
+		},
+		Durations: func(p Params, inputDuration float64) []float64 {
+			return []float64{inputDuration + p.Float("start_seconds") + p.Float("end_seconds")}
+		},
+	})
+
+	RegisterOperation(&Operation{
+		Name:  "select_streams",
+		Label: "Select Streams",
+		Params: []ParamSpec{
+			{Name: "streams", Label: "Streams", Type: ParamList, Required: true},
+		},
+		OutputSuffix: "_streams",
+		Validate: func(p Params) error {
+			_, err := selectedStreams(p)
+			return err
+		},
+		CheckInput: func(p Params, info *models.FileInfo) error {
+			streams, _ := selectedStreams(p)
+
+			types := make(map[int]string, len(info.Streams))
+			for _, stream := range info.Streams {
+				types[stream.Index] = stream.Type
+			}
+
+			defaults := make(map[string]bool)
+			for _, stream := range streams {
+				streamType, ok := types[stream.Index]
+				if !ok {
+					return fmt.Errorf("input has no stream %d", stream.Index)
+				}
+				if stream.Default {
+					if defaults[streamType] {
+						return fmt.Errorf("only one %s stream can be the default", streamType)
+					}
+					defaults[streamType] = true
+				}
+			}
+			return nil
+		},
+		Build: func(input, output string, p Params) [][]string {
+			streams, _ := selectedStreams(p)
+			return [][]string{BuildSelectStreamsCommand(input, output, streams)}
+		},
+	})
+}
+
+// clampDuration keeps a computed output length from going negative when the
+// parameters reach past the end of the input.
+func clampDuration(seconds float64) float64 {
+	return max(seconds, 0)
+}
+
+func selectedStreams(p Params) ([]models.StreamSelection, error) {
+	var streams []models.StreamSelection
+	if err := p.Decode("streams", &streams); err != nil {
+		return nil, err
+	}
+	if len(streams) == 0 {
+		return nil, fmt.Errorf("select at least one stream")
+	}
+
+	seen := make(map[int]bool, len(streams))
+	for _, stream := range streams {
+		if stream.Index < 0 {
+			return nil, fmt.Errorf("invalid stream index %d", stream.Index)
+		}
+		if seen[stream.Index] {
+			return nil, fmt.Errorf("stream %d is selected twice", stream.Index)
+		}
+		seen[stream.Index] = true
+
+		if stream.Language != "" && !languageTag.MatchString(stream.Language) {
+			return nil, fmt.Errorf("stream %d: invalid language code %q", stream.Index, stream.Language)
+		}
+	}
+	return streams, nil
+}
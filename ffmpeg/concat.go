@@ -0,0 +1,275 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"ffwd-ui/models"
+)
+
+// concatListFile is the name of the concat demuxer's file list in WorkDir.
+const concatListFile = "concat.txt"
+
+func init() {
+	RegisterOperation(&Operation{
+		Name:  "concat",
+		Label: "Join Files",
+		Params: []ParamSpec{
+			{Name: "inputs", Label: "Files to append", Type: ParamList, Required: true},
+			{Name: "mode", Label: "Mode", Type: ParamString, Default: "auto", Options: []string{"auto", "copy", "reencode"}},
+			{Name: "width", Label: "Width", Type: ParamInt, Default: 0, Min: floatPtr(0)},
+			{Name: "height", Label: "Height", Type: ParamInt, Default: 0, Min: floatPtr(0)},
+			{Name: "sample_rate", Label: "Sample rate", Type: ParamInt, Default: 0, Min: floatPtr(0)},
+			{Name: "video", Label: "Include video", Type: ParamBool, Default: true},
+			{Name: "audio", Label: "Include audio", Type: ParamBool, Default: true},
+		},
+		OutputSuffix: "_joined",
+		Standalone:   true,
+		Validate: func(p Params) error {
+			inputs, err := concatInputs(p)
+			if err != nil {
+				return err
+			}
+			if len(inputs) == 0 {
+				return fmt.Errorf("add at least one file to append")
+			}
+			if !p.Bool("video") && !p.Bool("audio") {
+				return fmt.Errorf("include video, audio or both")
+			}
+			return nil
+		},
+		Plan: planConcat,
+		Inputs: func(p Params) []string {
+			inputs, _ := concatInputs(p)
+			return inputs
+		},
+		Build: func(input, output string, p Params) [][]string {
+			inputs, _ := concatInputs(p)
+			if p.String("mode") == "reencode" {
+				return [][]string{BuildConcatFilterCommand(append([]string{input}, inputs...), output,
+					p.Int("width"), p.Int("height"), p.Int("sample_rate"), p.Bool("video"), p.Bool("audio"))}
+			}
+			return [][]string{BuildConcatCopyCommand(output, p.Bool("video"), p.Bool("audio"))}
+		},
+		Files: func(input string, p Params) map[string]string {
+			if p.String("mode") == "reencode" {
+				return nil
+			}
+			inputs, _ := concatInputs(p)
+			return map[string]string{concatListFile: BuildConcatList(append([]string{input}, inputs...))}
+		},
+	})
+}
+
+// BuildConcatCopyCommand joins the files listed in the concat list in
+// WorkDir with the concat demuxer, without re-encoding. The files must have
+// the same streams with the same codecs and parameters.
+func BuildConcatCopyCommand(output string, video, audio bool) []string {
+	args := []string{
+		"-f", "concat",
+		"-safe", "0",
+		"-i", WorkDir + "/" + concatListFile,
+		"-map", "0",
+	}
+	if !video {
+		args = append(args, "-vn")
+	}
+	if !audio {
+		args = append(args, "-an")
+	}
+	return append(args, "-c", "copy", output)
+}
+
+// BuildConcatFilterCommand joins inputs with the concat filter, first
+// scaling every video to width x height (letterboxed to keep its aspect
+// ratio) and resampling every audio track to stereo at sampleRate.
+func BuildConcatFilterCommand(inputs []string, output string, width, height, sampleRate int, video, audio bool) []string {
+	if width <= 0 || height <= 0 {
+		width, height = 1280, 720
+	}
+	if sampleRate <= 0 {
+		sampleRate = 48000
+	}
+
+	var args []string
+	for _, input := range inputs {
+		args = append(args, "-i", SafePath(input))
+	}
+
+	var filters []string
+	var segments strings.Builder
+	for i := range inputs {
+		if video {
+			filters = append(filters, fmt.Sprintf(
+				"[%d:v:0]scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setsar=1[v%d]",
+				i, width, height, width, height, i))
+			fmt.Fprintf(&segments, "[v%d]", i)
+		}
+		if audio {
+			filters = append(filters, fmt.Sprintf(
+				"[%d:a:0]aresample=%d,aformat=sample_fmts=fltp:channel_layouts=stereo[a%d]",
+				i, sampleRate, i))
+			fmt.Fprintf(&segments, "[a%d]", i)
+		}
+	}
+
+	v, a := 0, 0
+	var outputs string
+	if video {
+		v = 1
+		outputs += "[v]"
+	}
+	if audio {
+		a = 1
+		outputs += "[a]"
+	}
+	filters = append(filters, fmt.Sprintf("%sconcat=n=%d:v=%d:a=%d%s", segments.String(), len(inputs), v, a, outputs))
+
+	args = append(args, "-filter_complex", strings.Join(filters, ";"))
+	if video {
+		args = append(args, "-map", "[v]")
+	}
+	if audio {
+		args = append(args, "-map", "[a]")
+	}
+	return append(args, output)
+}
+
+// BuildConcatList renders a concat demuxer file list. Paths are made
+// absolute because the list is read from the work directory.
+func BuildConcatList(inputs []string) string {
+	var b strings.Builder
+	for _, input := range inputs {
+		if abs, err := filepath.Abs(input); err == nil {
+			input = abs
+		}
+		fmt.Fprintf(&b, "file '%s'\n", strings.ReplaceAll(input, "'", `'\''`))
+	}
+	return b.String()
+}
+
+// planConcat probes the appended files, decides between the concat demuxer
+// and the concat filter when the mode is "auto", fills in the common format
+// for re-encoding and returns the total duration of all files.
+func planConcat(p Params, info *models.FileInfo, output string) (float64, error) {
+	inputs, _ := concatInputs(p)
+
+	infos := []*models.FileInfo{info}
+	total := info.Duration
+	for _, input := range inputs {
+		clip, err := ProbeFile(input)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", input, err)
+		}
+		infos = append(infos, clip)
+		total += clip.Duration
+	}
+
+	if mainVideoStream(info) == nil {
+		p["video"] = false
+	}
+	if firstAudioStream(info) == nil {
+		p["audio"] = false
+	}
+	if !p.Bool("video") && !p.Bool("audio") {
+		return 0, fmt.Errorf("%s has no video or audio to join", filepath.Base(info.Path))
+	}
+	for _, clip := range infos[1:] {
+		if p.Bool("video") && mainVideoStream(clip) == nil {
+			return 0, fmt.Errorf("%s has no video", filepath.Base(clip.Path))
+		}
+		if p.Bool("audio") && firstAudioStream(clip) == nil {
+			return 0, fmt.Errorf("%s has no audio", filepath.Base(clip.Path))
+		}
+	}
+
+	mismatch := concatMismatch(infos)
+	switch p.String("mode") {
+	case "auto":
+		p["mode"] = "copy"
+		if mismatch != "" {
+			p["mode"] = "reencode"
+		}
+	case "copy":
+		if mismatch != "" {
+			return 0, fmt.Errorf("the files cannot be joined without re-encoding: %s", mismatch)
+		}
+	}
+
+	if p.String("mode") == "reencode" {
+		if stream := mainVideoStream(info); stream != nil && (p.Int("width") == 0 || p.Int("height") == 0) {
+			p["width"] = stream.Width &^ 1
+			p["height"] = stream.Height &^ 1
+		}
+		if stream := firstAudioStream(info); stream != nil && p.Int("sample_rate") == 0 {
+			p["sample_rate"] = stream.SampleRate
+		}
+	}
+
+	return total, nil
+}
+
+// concatMismatch describes the first difference that stops infos from being
+// joined with the concat demuxer, or returns "" if there is none.
+func concatMismatch(infos []*models.FileInfo) string {
+	first := infos[0]
+	firstVideo := mainVideoStream(first)
+	firstAudio := firstAudioStream(first)
+
+	for _, clip := range infos[1:] {
+		name := filepath.Base(clip.Path)
+
+		if !maps.Equal(countStreams(clip), countStreams(first)) {
+			return fmt.Sprintf("%s has different streams", name)
+		}
+
+		if video := mainVideoStream(clip); firstVideo != nil && video != nil {
+			switch {
+			case video.Codec != firstVideo.Codec:
+				return fmt.Sprintf("%s uses %s video, not %s", name, video.Codec, firstVideo.Codec)
+			case video.Width != firstVideo.Width || video.Height != firstVideo.Height:
+				return fmt.Sprintf("%s is %dx%d, not %dx%d", name, video.Width, video.Height, firstVideo.Width, firstVideo.Height)
+			case video.PixelFormat != firstVideo.PixelFormat:
+				return fmt.Sprintf("%s uses pixel format %s, not %s", name, video.PixelFormat, firstVideo.PixelFormat)
+			case math.Abs(video.FrameRate-firstVideo.FrameRate) > 0.01:
+				return fmt.Sprintf("%s runs at %.3g fps, not %.3g", name, video.FrameRate, firstVideo.FrameRate)
+			}
+		}
+
+		if audio := firstAudioStream(clip); firstAudio != nil && audio != nil {
+			switch {
+			case audio.Codec != firstAudio.Codec:
+				return fmt.Sprintf("%s uses %s audio, not %s", name, audio.Codec, firstAudio.Codec)
+			case audio.SampleRate != firstAudio.SampleRate:
+				return fmt.Sprintf("%s has a sample rate of %d Hz, not %d", name, audio.SampleRate, firstAudio.SampleRate)
+			case audio.Channels != firstAudio.Channels:
+				return fmt.Sprintf("%s has %d audio channels, not %d", name, audio.Channels, firstAudio.Channels)
+			}
+		}
+	}
+	return ""
+}
+
+func countStreams(info *models.FileInfo) map[string]int {
+	counts := make(map[string]int)
+	for _, stream := range info.Streams {
+		counts[stream.Type]++
+	}
+	return counts
+}
+
+func concatInputs(p Params) ([]string, error) {
+	var inputs []string
+	if err := p.Decode("inputs", &inputs); err != nil {
+		return nil, err
+	}
+	for i, input := range inputs {
+		if input == "" {
+			return nil, fmt.Errorf("file %d has no path", i+1)
+		}
+	}
+	return inputs, nil
+}
@@ -0,0 +1,154 @@
+package ffmpeg
+
+import (
+	"strconv"
+	"strings"
+
+	"ffwd-ui/models"
+)
+
+// Audio bitrates in bit/s assumed for encoders driven by quality rather
+// than bitrate, and for encoders given no bitrate.
+const (
+	mp3QualityBitrate   = 190_000 // libmp3lame -q:a 2
+	defaultAudioBitrate = 128_000
+
+	// flacRatio is the share of the PCM size FLAC usually compresses to.
+	flacRatio = 0.6
+)
+
+// EstimateSize returns the expected size in bytes of the operation's
+// output for info, where inputDuration is what Prepare returned. It is a
+// guess for checking free space, not a promise: stream copies keep the
+// input's bitrate over the output's length, and encodes use the target
+// bitrate when there is one.
+func (op *Operation) EstimateSize(p Params, info *models.FileInfo, inputDuration float64) int64 {
+	seconds := op.OutputDuration(p, inputDuration)
+	if op.Estimate != nil {
+		return int64(op.Estimate(p, info, seconds))
+	}
+	return int64(copyEstimate(info, seconds))
+}
+
+// copyEstimate is the size of seconds of info at its overall bitrate.
+func copyEstimate(info *models.FileInfo, seconds float64) float64 {
+	if info.Duration > 0 && info.Size > 0 {
+		return float64(info.Size) * seconds / info.Duration
+	}
+	return float64(info.Bitrate) * seconds / 8
+}
+
+// streamBitrates returns the bitrates in bit/s of the main video stream
+// and the first audio stream of info. A video stream that does not report
+// its bitrate is given what is left of the overall bitrate.
+func streamBitrates(info *models.FileInfo) (video, audio float64) {
+	if stream := firstAudioStream(info); stream != nil {
+		audio = float64(stream.Bitrate)
+	}
+	if stream := mainVideoStream(info); stream != nil {
+		video = float64(stream.Bitrate)
+		if video == 0 {
+			total := float64(info.Bitrate)
+			if total == 0 && info.Duration > 0 {
+				total = float64(info.Size) * 8 / info.Duration
+			}
+			video = max(total-audio, 0)
+		}
+	}
+	return video, audio
+}
+
+// pcmBitrate returns the bitrate of the first audio stream of info as
+// 16-bit PCM.
+func pcmBitrate(info *models.FileInfo) float64 {
+	stream := firstAudioStream(info)
+	if stream == nil {
+		return 0
+	}
+	rate, channels := stream.SampleRate, stream.Channels
+	if rate == 0 {
+		rate = 48000
+	}
+	if channels == 0 {
+		channels = 2
+	}
+	return float64(rate * channels * 16)
+}
+
+// parseBitrate converts a bitrate as ffmpeg takes it, such as 192k or
+// 2.5M, to bit/s. It returns 0 for anything else.
+func parseBitrate(value string) float64 {
+	if !bitrateValue.MatchString(value) {
+		return 0
+	}
+
+	scale := 1.0
+	switch strings.ToLower(value[len(value)-1:]) {
+	case "k":
+		scale, value = 1e3, value[:len(value)-1]
+	case "m":
+		scale, value = 1e6, value[:len(value)-1]
+	}
+	number, _ := strconv.ParseFloat(value, 64)
+	return number * scale
+}
+
+// estimateAudio sizes extract_audio from the bitrate of its format.
+func estimateAudio(p Params, info *models.FileInfo, seconds float64) float64 {
+	var bitrate float64
+	switch p.String("format") {
+	case "aac":
+		bitrate = 192_000
+	case "wav":
+		bitrate = pcmBitrate(info)
+	case "flac":
+		bitrate = pcmBitrate(info) * flacRatio
+	default:
+		bitrate = mp3QualityBitrate
+	}
+	return bitrate * seconds / 8
+}
+
+// estimateScaled sizes an encode that changes the frame size of the video
+// to width×height, assuming the bitrate follows the number of pixels. The
+// audio is copied.
+func estimateScaled(info *models.FileInfo, seconds float64, width, height int) float64 {
+	video, audio := streamBitrates(info)
+	if stream := mainVideoStream(info); stream != nil && stream.Width > 0 && stream.Height > 0 {
+		aspect := float64(stream.Width) / float64(stream.Height)
+		w, h := float64(width), float64(height)
+		switch {
+		case w <= 0 && h <= 0:
+			w, h = float64(stream.Width), float64(stream.Height)
+		case w <= 0:
+			w = h * aspect
+		case h <= 0:
+			h = w / aspect
+		}
+		video *= w * h / float64(stream.Width*stream.Height)
+	}
+	return (video + audio) * seconds / 8
+}
+
+// estimateResolution sizes change_resolution, where one dimension may be
+// zero to keep the aspect ratio.
+func estimateResolution(p Params, info *models.FileInfo, seconds float64) float64 {
+	return estimateScaled(info, seconds, p.Int("width"), p.Int("height"))
+}
+
+func estimateCrop(p Params, info *models.FileInfo, seconds float64) float64 {
+	return estimateScaled(info, seconds, p.Int("width"), p.Int("height"))
+}
+
+// estimateBitrate sizes adjust_bitrate from its target bitrates, keeping
+// the input's bitrate for a stream left unchanged.
+func estimateBitrate(p Params, info *models.FileInfo, seconds float64) float64 {
+	video, audio := streamBitrates(info)
+	if bitrate := parseBitrate(p.String("video_bitrate")); bitrate > 0 {
+		video = bitrate
+	}
+	if bitrate := parseBitrate(p.String("audio_bitrate")); bitrate > 0 && audio > 0 {
+		audio = bitrate
+	}
+	return (video + audio) * seconds / 8
+}
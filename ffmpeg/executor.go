@@ -3,32 +3,84 @@ package ffmpeg
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"os"
 	"os/exec"
-	"regexp"
-	"strconv"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
+
+	"ffwd-ui/models"
 )
 
+// WorkDir is a placeholder that may appear in command arguments. The
+// executor replaces it with a private temporary directory for the job, for
+// files such as two-pass logs that must not outlive it.
+const WorkDir = "{workdir}"
+
+// ErrPauseUnsupported is returned by Pause where ffmpeg cannot be
+// suspended.
+var ErrPauseUnsupported = errors.New("pausing ffmpeg is not supported on this system")
+
+// ErrCancelled is reported through the error callback when a running
+// operation is stopped with Cancel.
+var ErrCancelled = errors.New("operation cancelled")
+
+// ErrTimeout is reported through the error callback when a pass runs for
+// longer than the limit set with SetPassTimeout.
+var ErrTimeout = errors.New("ffmpeg timed out")
+
 type Executor struct {
 	ctx          context.Context
 	ffmpegCtx    context.Context
 	ffmpegCancel context.CancelFunc
 	currentCmd   *exec.Cmd
 	mu           sync.Mutex
-	onProgress   func(percent float64, message string)
+	onProgress   func(models.ProgressUpdate)
 	onComplete   func()
 	onError      func(error)
+	stderrTail   []string
+	workFiles    map[string]string
+	verify       func(attempt int) ([][]string, []float64, error)
+	fallback     func() ([][]string, []float64)
+	paused       bool
+	cancelReason string
+	output       string
+	passTimeout  time.Duration
+	timer        *time.Timer
+	timerStarted time.Time
+	timeLeft     time.Duration
+	timedOut     bool
+}
+
+// DefaultPassTimeout is how long each ffmpeg invocation may run unless
+// SetPassTimeout says otherwise.
+const DefaultPassTimeout = 30 * time.Minute
+
+// GlobalArgs returns the options the executor puts before the arguments of
+// every pass: no banner, no reading from stdin, and overwriting the output,
+// which is the executor's temporary file.
+func GlobalArgs() []string {
+	return []string{"-hide_banner", "-nostdin", "-y"}
 }
 
+// stderrTailLines is how many lines of ffmpeg's stderr are kept for
+// StderrTail.
+const stderrTailLines = 20
+
 func NewExecutor(ctx context.Context) *Executor {
 	return &Executor{
-		ctx: ctx,
+		ctx:         ctx,
+		passTimeout: DefaultPassTimeout,
 	}
 }
 
-func (e *Executor) SetProgressCallback(cb func(percent float64, message string)) {
+func (e *Executor) SetProgressCallback(cb func(models.ProgressUpdate)) {
 	e.onProgress = cb
 }
 
@@ -40,74 +92,164 @@ func (e *Executor) SetErrorCallback(cb func(error)) {
 	e.onError = cb
 }
 
+// SetWorkFiles sets files to create in the work directory before the first
+// pass, keyed by file name, such as metadata that ffmpeg reads as an input.
+func (e *Executor) SetWorkFiles(files map[string]string) {
+	e.workFiles = files
+}
+
+// SetVerify sets a check that runs once the passes have succeeded, with
+// attempt counting the runs so far. When it returns passes, they run in the
+// same work directory with the given durations, and the check runs again
+// afterwards. An error fails the operation.
+func (e *Executor) SetVerify(verify func(attempt int) ([][]string, []float64, error)) {
+	e.verify = verify
+}
+
+// SetOutput makes the passes write output, wherever it appears as an
+// argument, to a temporary file in the same directory instead. The file is
+// renamed to output once the passes succeed, before the check set with
+// SetVerify runs, and removed when they fail or are cancelled, so that
+// output never holds a partial file. Every pass runs with -y, since the
+// temporary file belongs to the operation.
+func (e *Executor) SetOutput(output string) {
+	e.output = output
+}
+
+// SetFallback sets a function that is called once when a pass fails for
+// a reason other than Cancel. When it returns passes, such as the same
+// encode in software after a hardware encoder failed, they run from the
+// start in the same work directory with the given durations.
+func (e *Executor) SetFallback(fallback func() ([][]string, []float64)) {
+	e.fallback = fallback
+}
+
+// SetPassTimeout limits how long each ffmpeg invocation may run, so that
+// one that hangs does not hold its place in the queue forever. A pass that
+// runs over is stopped and the operation fails with ErrTimeout. Time spent
+// paused does not count. The default is DefaultPassTimeout, and zero sets
+// no limit.
+func (e *Executor) SetPassTimeout(timeout time.Duration) {
+	e.passTimeout = timeout
+}
+
 func (e *Executor) Execute(args []string, duration float64) error {
-	e.mu.Lock()
+	return e.ExecutePasses([][]string{args}, []float64{duration})
+}
+
+// ExecutePasses runs several ffmpeg invocations in order as one logical
+// operation, such as both passes of a two-pass encode. Every occurrence of
+// WorkDir in the arguments is replaced with a temporary directory that is
+// removed afterwards. durations holds the length in seconds of the media
+// each pass writes; a pass without an entry uses the last one given.
+// Progress is divided between the passes by their durations, and Cancel
+// stops whichever pass is running.
+func (e *Executor) ExecutePasses(passes [][]string, durations []float64) error {
+	if len(passes) == 0 {
+		return fmt.Errorf("no ffmpeg command to run")
+	}
 
-	ctx, cancel := context.WithTimeout(e.ctx, 30*time.Minute)
+	e.mu.Lock()
+	if e.ffmpegCancel != nil {
+		e.mu.Unlock()
+		return fmt.Errorf("operation already running")
+	}
+	ctx, cancel := context.WithCancel(e.ctx)
 	e.ffmpegCtx = ctx
 	e.ffmpegCancel = cancel
+	e.stderrTail = nil
+	e.paused = false
+	e.cancelReason = ""
+	e.timedOut = false
+	e.mu.Unlock()
 
-	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
-	e.currentCmd = cmd
-
-	stderr, err := cmd.StderrPipe()
+	workDir, err := os.MkdirTemp("", "ffwd-job-")
 	if err != nil {
-		e.mu.Unlock()
-		return fmt.Errorf("failed to get stderr pipe: %w", err)
+		e.reset()
+		cancel()
+		return fmt.Errorf("failed to create work directory: %w", err)
 	}
-
-	if err := cmd.Start(); err != nil {
-		e.mu.Unlock()
-		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	if err := writeWorkFiles(workDir, e.workFiles); err != nil {
+		os.RemoveAll(workDir)
+		e.reset()
+		cancel()
+		return err
 	}
+	passes = expandWorkDir(passes, workDir)
+	partial := partialPath(e.output)
+	passes = replaceOutput(passes, e.output, partial)
 
-	e.mu.Unlock()
+	// The first pass is started here so that a missing ffmpeg binary is
+	// reported to the caller rather than through the error callback.
+	wait, err := e.startPass(ctx, passes, 0, durations)
+	if err != nil {
+		os.RemoveAll(workDir)
+		e.reset()
+		cancel()
+		return err
+	}
 
 	go func() {
-		scanner := bufio.NewScanner(stderr)
-		timeRegex := regexp.MustCompile(`time=(\d{2}):(\d{2}):(\d{2}\.\d{2})`)
+		err := wait()
+		if err == nil {
+			err = e.runPasses(ctx, passes, 1, durations)
+		}
 
-		for scanner.Scan() {
-			line := scanner.Text()
-
-			if matches := timeRegex.FindStringSubmatch(line); len(matches) == 4 {
-				hours, _ := strconv.ParseFloat(matches[1], 64)
-				minutes, _ := strconv.ParseFloat(matches[2], 64)
-				seconds, _ := strconv.ParseFloat(matches[3], 64)
-
-				currentTime := hours*3600 + minutes*60 + seconds
-
-				if duration > 0 {
-					percent := (currentTime / duration) * 100
-					if percent > 100 {
-						percent = 100
-					}
-					if e.onProgress != nil {
-						e.onProgress(percent, fmt.Sprintf("Processing... %.1f%%", percent))
-					}
-				}
+		if err != nil && ctx.Err() == nil && e.fallback != nil {
+			if fallback, fallbackDurations := e.fallback(); len(fallback) > 0 {
+				e.appendStderr("Falling back to: " + BuildPassesString(fallback))
+				passes, durations = replaceOutput(expandWorkDir(fallback, workDir), e.output, partial), fallbackDurations
+				err = e.runPasses(ctx, passes, 0, durations)
 			}
 		}
-	}()
 
-	go func() {
-		err := cmd.Wait()
+		var finishErr error
+		if err == nil {
+			finishErr = commitOutput(partial, e.output)
+		}
+		for attempt := 1; err == nil && finishErr == nil && e.verify != nil; attempt++ {
+			var retry [][]string
+			retry, durations, finishErr = e.verify(attempt)
+			if finishErr != nil || len(retry) == 0 {
+				break
+			}
+			passes = replaceOutput(expandWorkDir(retry, workDir), e.output, partial)
+			if err = e.runPasses(ctx, passes, 0, durations); err == nil {
+				finishErr = commitOutput(partial, e.output)
+			}
+		}
+		if partial != "" {
+			os.Remove(partial)
+		}
 
+		cancelled := ctx.Err() == context.Canceled
 		e.mu.Lock()
-		e.ffmpegCancel = nil
-		e.currentCmd = nil
+		reason, timedOut := e.cancelReason, e.timedOut
 		e.mu.Unlock()
+		os.RemoveAll(workDir)
+		e.reset()
+		cancel()
 
 		if err != nil {
-			if ctx.Err() == context.Canceled {
+			if timedOut {
 				if e.onError != nil {
-					e.onError(fmt.Errorf("operation cancelled"))
+					e.onError(fmt.Errorf("%w: a pass ran for more than %s", ErrTimeout, e.passTimeout))
+				}
+			} else if cancelled {
+				if e.onError != nil && reason != "" {
+					e.onError(fmt.Errorf("%w: %s", ErrCancelled, reason))
+				} else if e.onError != nil {
+					e.onError(ErrCancelled)
 				}
 			} else {
 				if e.onError != nil {
 					e.onError(fmt.Errorf("ffmpeg error: %w", err))
 				}
 			}
+		} else if finishErr != nil {
+			if e.onError != nil {
+				e.onError(finishErr)
+			}
 		} else {
 			if e.onComplete != nil {
 				e.onComplete()
@@ -118,6 +260,153 @@ func (e *Executor) Execute(args []string, duration float64) error {
 	return nil
 }
 
+// runPasses runs passes from index first on, stopping at the first that
+// fails.
+func (e *Executor) runPasses(ctx context.Context, passes [][]string, first int, durations []float64) error {
+	for i := first; i < len(passes); i++ {
+		wait, err := e.startPass(ctx, passes, i, durations)
+		if err != nil {
+			return err
+		}
+		if err := wait(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startPass starts passes[index] and returns a function that waits for it
+// to exit.
+func (e *Executor) startPass(ctx context.Context, passes [][]string, index int, durations []float64) (func() error, error) {
+	args := append(append(GlobalArgs(), progressArgs...), passes[index]...)
+	cmd := exec.CommandContext(ctx, ffmpegBinary(), args...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stdout pipe: %w", err)
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stderr pipe: %w", err)
+	}
+
+	e.mu.Lock()
+	if ctx.Err() != nil {
+		e.mu.Unlock()
+		return nil, ctx.Err()
+	}
+	if err := cmd.Start(); err != nil {
+		e.mu.Unlock()
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	e.currentCmd = cmd
+	if e.paused {
+		suspendProcess(cmd.Process)
+	}
+	if e.passTimeout > 0 {
+		e.timeLeft = e.passTimeout
+		if !e.paused {
+			e.startTimer()
+		}
+	}
+	e.mu.Unlock()
+
+	// Both pipes must be drained before Wait is called.
+	var readers sync.WaitGroup
+	readers.Add(2)
+
+	go func() {
+		defer readers.Done()
+		readProgress(stdout, passDuration(durations, index), func(update models.ProgressUpdate) {
+			if len(passes) > 1 {
+				scalePassProgress(&update, index, len(passes), durations)
+			}
+			if e.onProgress != nil {
+				e.onProgress(update)
+			}
+		})
+	}()
+
+	go func() {
+		defer readers.Done()
+		scanner := bufio.NewScanner(stderr)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			e.appendStderr(scanner.Text())
+		}
+		io.Copy(io.Discard, stderr)
+	}()
+
+	return func() error {
+		readers.Wait()
+		err := cmd.Wait()
+		e.mu.Lock()
+		e.stopTimer()
+		e.timeLeft = 0
+		e.mu.Unlock()
+		return err
+	}, nil
+}
+
+// startTimer starts the timeout of the running pass for the time it has
+// left. e.mu must be held.
+func (e *Executor) startTimer() {
+	var timer *time.Timer
+	timer = time.AfterFunc(e.timeLeft, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		// A timer stopped too late to keep it from firing is no longer
+		// e.timer and must not stop a later pass.
+		if e.timer == timer && e.ffmpegCancel != nil {
+			e.timedOut = true
+			e.ffmpegCancel()
+		}
+	})
+	e.timer = timer
+	e.timerStarted = time.Now()
+}
+
+// stopTimer stops the timeout of the running pass and keeps the time it has
+// left. e.mu must be held.
+func (e *Executor) stopTimer() {
+	if e.timer == nil {
+		return
+	}
+	e.timer.Stop()
+	e.timeLeft -= time.Since(e.timerStarted)
+	e.timer = nil
+}
+
+// StderrTail returns the last lines ffmpeg wrote to stderr during the most
+// recent operation, across all of its passes.
+func (e *Executor) StderrTail() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.stderrTail...)
+}
+
+func (e *Executor) appendStderr(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.stderrTail = append(e.stderrTail, line)
+	if len(e.stderrTail) > stderrTailLines {
+		e.stderrTail = e.stderrTail[len(e.stderrTail)-stderrTailLines:]
+	}
+}
+
+func (e *Executor) reset() {
+	e.mu.Lock()
+	e.ffmpegCancel = nil
+	e.currentCmd = nil
+	e.mu.Unlock()
+}
+
 func (e *Executor) Cancel() error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
@@ -130,8 +419,144 @@ func (e *Executor) Cancel() error {
 	return fmt.Errorf("no operation running")
 }
 
+// CancelWithReason stops the running operation like Cancel, and the error
+// callback receives ErrCancelled wrapped with reason.
+func (e *Executor) CancelWithReason(reason string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.ffmpegCancel == nil {
+		return fmt.Errorf("no operation running")
+	}
+	e.cancelReason = reason
+	e.ffmpegCancel()
+	return nil
+}
+
+// Pause suspends the running ffmpeg process, and any later pass of the
+// operation as soon as it starts, until Resume. The pass timeout stops
+// with it. A paused operation can still be cancelled.
+func (e *Executor) Pause() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.ffmpegCancel == nil {
+		return fmt.Errorf("no operation running")
+	}
+	if !pauseSupported {
+		return ErrPauseUnsupported
+	}
+	if e.currentCmd != nil && e.currentCmd.Process != nil {
+		if err := suspendProcess(e.currentCmd.Process); err != nil {
+			return err
+		}
+	}
+	e.stopTimer()
+	e.paused = true
+	return nil
+}
+
+// Resume continues an operation stopped with Pause.
+func (e *Executor) Resume() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.paused {
+		return nil
+	}
+	if e.currentCmd != nil && e.currentCmd.Process != nil {
+		if err := resumeProcess(e.currentCmd.Process); err != nil {
+			return err
+		}
+	}
+	if e.timeLeft > 0 {
+		e.startTimer()
+	}
+	e.paused = false
+	return nil
+}
+
 func (e *Executor) IsRunning() bool {
 	e.mu.Lock()
 	defer e.mu.Unlock()
-	return e.currentCmd != nil
+	return e.ffmpegCancel != nil
+}
+
+// passDuration returns the output length of pass index, falling back to the
+// last duration given.
+func passDuration(durations []float64, index int) float64 {
+	if len(durations) == 0 {
+		return 0
+	}
+	if index >= len(durations) {
+		index = len(durations) - 1
+	}
+	return durations[index]
+}
+
+func writeWorkFiles(workDir string, files map[string]string) error {
+	for name, content := range files {
+		if name != filepath.Base(name) {
+			return fmt.Errorf("invalid work file name %q", name)
+		}
+		if err := os.WriteFile(filepath.Join(workDir, name), []byte(content), 0o600); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// partialPath returns the temporary file that output is written to until
+// the operation succeeds: a hidden file in the same directory, so that the
+// rename does not cross file systems, with the same extension, so that
+// ffmpeg picks the same format. It returns "" for no output.
+func partialPath(output string) string {
+	if output == "" {
+		return ""
+	}
+	dir, name := filepath.Split(output)
+	ext := filepath.Ext(name)
+	return SafePath(filepath.Join(dir, fmt.Sprintf(".%s.%08x.part%s", strings.TrimSuffix(name, ext), rand.Uint32(), ext)))
+}
+
+// replaceOutput returns passes with every argument equal to output
+// replaced by partial.
+func replaceOutput(passes [][]string, output, partial string) [][]string {
+	if output == "" {
+		return passes
+	}
+	for _, args := range passes {
+		for i, arg := range args {
+			if arg == output {
+				args[i] = partial
+			}
+		}
+	}
+	return passes
+}
+
+// commitOutput renames the finished partial file to output. Operations
+// whose passes do not name the output leave no partial file to rename.
+func commitOutput(partial, output string) error {
+	if partial == "" {
+		return nil
+	}
+	if _, err := os.Stat(partial); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err := os.Rename(partial, output); err != nil {
+		return fmt.Errorf("failed to move the output into place: %w", err)
+	}
+	return nil
+}
+
+func expandWorkDir(passes [][]string, workDir string) [][]string {
+	expanded := make([][]string, len(passes))
+	for i, args := range passes {
+		expanded[i] = make([]string, len(args))
+		for j, arg := range args {
+			expanded[i][j] = strings.ReplaceAll(arg, WorkDir, workDir)
+		}
+	}
+	return expanded
 }
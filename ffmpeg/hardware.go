@@ -0,0 +1,252 @@
+package ffmpeg
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"ffwd-ui/models"
+)
+
+// hardwareAPIs are the acceleration APIs probed for encoders, in order of
+// preference.
+var hardwareAPIs = []string{"nvenc", "qsv", "vaapi", "videotoolbox", "amf", "v4l2m2m"}
+
+// hardwareCodecs are the codecs probed for each API, in order of
+// preference.
+var hardwareCodecs = []string{"h264", "hevc", "av1"}
+
+// testEncodeTimeout bounds each test encode, since a broken driver can hang
+// instead of failing.
+const testEncodeTimeout = 15 * time.Second
+
+var (
+	hardwareMu       sync.Mutex
+	hardwareEncoders []models.HardwareEncoder
+	hardwareProbed   bool
+)
+
+// HardwareEncoders returns the hardware encoders that can encode on this
+// machine. The first call lists ffmpeg's encoders and test-encodes a few
+// synthetic frames with each candidate; later calls return the cached
+// result until RefreshHardwareEncoders.
+func HardwareEncoders() []models.HardwareEncoder {
+	hardwareMu.Lock()
+	defer hardwareMu.Unlock()
+
+	if !hardwareProbed {
+		hardwareEncoders = probeHardwareEncoders()
+		hardwareProbed = true
+	}
+	return append([]models.HardwareEncoder{}, hardwareEncoders...)
+}
+
+// RefreshHardwareEncoders probes the hardware encoders again, for example
+// after a driver has been installed.
+func RefreshHardwareEncoders() []models.HardwareEncoder {
+	hardwareMu.Lock()
+	hardwareProbed = false
+	hardwareMu.Unlock()
+	return HardwareEncoders()
+}
+
+// DetectHardwareEncoder returns the preferred working H.264 hardware
+// encoder, or "none".
+func DetectHardwareEncoder() string {
+	for _, encoder := range HardwareEncoders() {
+		if encoder.Codec == "h264" {
+			return encoder.Name
+		}
+	}
+	return "none"
+}
+
+func probeHardwareEncoders() []models.HardwareEncoder {
+	available, err := readCapabilities(ffmpegBinary(), "-encoders")
+	if err != nil {
+		return nil
+	}
+
+	var candidates []models.HardwareEncoder
+	for _, api := range hardwareAPIs {
+		device := ""
+		if api == "vaapi" {
+			if device = vaapiDevice(); device == "" {
+				continue
+			}
+		}
+		for _, codec := range hardwareCodecs {
+			name := codec + "_" + api
+			if available[name] {
+				candidates = append(candidates, models.HardwareEncoder{Name: name, API: api, Codec: codec, Device: device})
+			}
+		}
+	}
+
+	working := make([]bool, len(candidates))
+	var wg sync.WaitGroup
+	for i, candidate := range candidates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			working[i] = testEncode(candidate)
+		}()
+	}
+	wg.Wait()
+
+	var encoders []models.HardwareEncoder
+	for i, candidate := range candidates {
+		if working[i] {
+			encoders = append(encoders, candidate)
+		}
+	}
+	return encoders
+}
+
+// testEncode reports whether encoder can encode a few frames of a lavfi
+// test source through the pipeline jobs use.
+func testEncode(encoder models.HardwareEncoder) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), testEncodeTimeout)
+	defer cancel()
+
+	inputArgs, videoArgs := hardwareVideoArgs(encoder, nil, "")
+	args := []string{"-hide_banner", "-v", "error"}
+	args = append(args, inputArgs...)
+	args = append(args, "-f", "lavfi", "-i", "testsrc2=size=320x240:rate=30:duration=0.2")
+	args = append(args, videoArgs...)
+	args = append(args, "-f", "null", "-")
+
+	return exec.CommandContext(ctx, ffmpegBinary(), args...).Run() == nil
+}
+
+// hardwareBackend describes how frames reach the encoders of one API.
+// Frames are decoded in software; upload turns them into frames on the
+// device, where scaler, if any, resizes them. Encoders that take software
+// frames get them in format instead, and an empty format means the
+// encoder only takes frames on the device.
+type hardwareBackend struct {
+	device func(device string) []string
+	upload []string
+	scaler string
+	format string
+}
+
+var hardwareBackends = map[string]hardwareBackend{
+	"vaapi": {
+		device: func(device string) []string { return []string{"-vaapi_device", device} },
+		upload: []string{"format=nv12", "hwupload"},
+		scaler: "scale_vaapi",
+	},
+	"qsv": {
+		device: func(string) []string { return []string{"-init_hw_device", "qsv=hw", "-filter_hw_device", "hw"} },
+		upload: []string{"format=nv12", "hwupload=extra_hw_frames=64"},
+		scaler: "scale_qsv",
+		format: "nv12",
+	},
+	"nvenc": {
+		device: func(string) []string { return []string{"-init_hw_device", "cuda=cu", "-filter_hw_device", "cu"} },
+		upload: []string{"format=nv12", "hwupload"},
+		scaler: "scale_cuda",
+		format: "yuv420p",
+	},
+	"videotoolbox": {format: "yuv420p"},
+	"amf":          {format: "yuv420p"},
+	"v4l2m2m":      {format: "nv12"},
+}
+
+// softwareEncoders are the encoders a failed hardware encode falls back
+// to, keyed by codec.
+var softwareEncoders = map[string]string{
+	"h264": "libx264",
+	"hevc": "libx265",
+	"av1":  "libsvtav1",
+}
+
+// IsHardwareEncoder reports whether name is a hardware video encoder.
+func IsHardwareEncoder(name string) bool {
+	_, ok := hardwareBackends[hardwareEncoderFor(name).API]
+	return ok
+}
+
+// SoftwareEncoder returns the software encoder producing the same codec as
+// the hardware encoder name, or "" if there is none.
+func SoftwareEncoder(name string) string {
+	return softwareEncoders[hardwareEncoderFor(name).Codec]
+}
+
+// fallbackHWAccel is the Fallback of operations with a hw_accel parameter,
+// which encode with ffmpeg's default encoder when it is "none".
+func fallbackHWAccel(p Params) bool {
+	if !IsHardwareEncoder(p.String("hw_accel")) {
+		return false
+	}
+	p["hw_accel"] = "none"
+	return true
+}
+
+// hardwareEncoderFor describes the encoder called name, such as
+// h264_vaapi, whether or not it passed a test encode.
+func hardwareEncoderFor(name string) models.HardwareEncoder {
+	codec, api, _ := strings.Cut(name, "_")
+	encoder := models.HardwareEncoder{Name: name, API: api, Codec: codec}
+	if api == "vaapi" {
+		encoder.Device = vaapiDevice()
+		if encoder.Device == "" {
+			encoder.Device = defaultVAAPIDevice
+		}
+	}
+	return encoder
+}
+
+// defaultVAAPIDevice is the render node commands use when none is found,
+// so that they fail on the missing device rather than on their arguments.
+const defaultVAAPIDevice = "/dev/dri/renderD128"
+
+// HardwareVideoArgs returns the arguments of a video encode with the
+// hardware encoder name: the options that open its device, which go before
+// -i, and the filters and codec options that go after it. filters run in
+// software first. An encoder that is not a known hardware encoder is given
+// its frames as they are. A non-empty size, as "width:height" with -2
+// keeping the aspect ratio at an even size, scales on the device when the
+// API has a scaler there, and in software otherwise.
+func HardwareVideoArgs(name string, filters []string, size string) (inputArgs, videoArgs []string) {
+	return hardwareVideoArgs(hardwareEncoderFor(name), filters, size)
+}
+
+func hardwareVideoArgs(encoder models.HardwareEncoder, filters []string, size string) (inputArgs, videoArgs []string) {
+	backend := hardwareBackends[encoder.API]
+	onDevice := backend.scaler != "" && (backend.format == "" || size != "")
+
+	chain := append([]string(nil), filters...)
+	if onDevice {
+		inputArgs = backend.device(encoder.Device)
+		chain = append(chain, backend.upload...)
+		if size != "" {
+			chain = append(chain, backend.scaler+"="+size)
+		}
+	} else {
+		if size != "" {
+			chain = append(chain, "scale="+size)
+		}
+		if backend.format != "" {
+			chain = append(chain, "format="+backend.format)
+		}
+	}
+
+	if len(chain) > 0 {
+		videoArgs = []string{"-vf", strings.Join(chain, ",")}
+	}
+	return inputArgs, append(videoArgs, "-c:v", encoder.Name)
+}
+
+// vaapiDevice returns the first DRM render node, or "" if there is none.
+func vaapiDevice() string {
+	nodes, _ := filepath.Glob("/dev/dri/renderD*")
+	if len(nodes) == 0 {
+		return ""
+	}
+	return nodes[0]
+}
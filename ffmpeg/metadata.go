@@ -0,0 +1,198 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"ffwd-ui/models"
+)
+
+// metadataFile is the name of the ffmetadata file in WorkDir.
+const metadataFile = "metadata.txt"
+
+// metadataFields are the container tags edit_metadata can set, in the
+// order they are written.
+var metadataFields = []string{"title", "artist", "comment", "date"}
+
+func init() {
+	RegisterOperation(&Operation{
+		Name:  "edit_metadata",
+		Label: "Edit Metadata",
+		Params: []ParamSpec{
+			{Name: "title", Label: "Title", Type: ParamString, Default: ""},
+			{Name: "artist", Label: "Artist", Type: ParamString, Default: ""},
+			{Name: "comment", Label: "Comment", Type: ParamString, Default: ""},
+			{Name: "date", Label: "Date", Type: ParamString, Default: ""},
+			{Name: "chapters", Label: "Chapters", Type: ParamList},
+			{Name: "clear_chapters", Label: "Remove existing chapters", Type: ParamBool, Default: false},
+		},
+		OutputSuffix: "_tagged",
+		Validate: func(p Params) error {
+			chapters, err := metadataChapters(p)
+			if err != nil {
+				return err
+			}
+			if len(chapters) > 0 && p.Bool("clear_chapters") {
+				return fmt.Errorf("chapters cannot be both set and removed")
+			}
+			if len(chapters) == 0 && !p.Bool("clear_chapters") && !hasMetadataTags(p) {
+				return fmt.Errorf("set a tag or chapters to change")
+			}
+			return nil
+		},
+		CheckInput: checkChapters,
+		Plan: func(p Params, info *models.FileInfo, output string) (float64, error) {
+			p[inputDurationParam] = info.Duration
+			return info.Duration, nil
+		},
+		Build: func(input, output string, p Params) [][]string {
+			chapters, _ := metadataChapters(p)
+			return [][]string{BuildEditMetadataCommand(input, output, len(chapters) > 0, p.Bool("clear_chapters"))}
+		},
+		Files: func(input string, p Params) map[string]string {
+			chapters, _ := metadataChapters(p)
+
+			tags := make(map[string]string)
+			for _, field := range metadataFields {
+				if value := p.String(field); value != "" {
+					tags[field] = value
+				}
+			}
+			return map[string]string{metadataFile: BuildFFMetadata(tags, chapters)}
+		},
+	})
+}
+
+// BuildEditMetadataCommand copies every stream of input unchanged and
+// applies the tags and chapters from the ffmetadata file in WorkDir. Tags
+// from the file take precedence and the input's other tags are kept, since
+// ffmpeg does not overwrite tags already mapped from an earlier input. The
+// input's chapters are kept unless the file provides new ones or
+// clearChapters is set.
+func BuildEditMetadataCommand(input, output string, replaceChapters, clearChapters bool) []string {
+	chapterSource := "0"
+	if replaceChapters {
+		chapterSource = "1"
+	} else if clearChapters {
+		chapterSource = "-1"
+	}
+
+	return []string{
+		"-i", input,
+		"-f", "ffmetadata",
+		"-i", WorkDir + "/" + metadataFile,
+		"-map", "0",
+		"-map_metadata", "1",
+		"-map_metadata", "0",
+		"-map_chapters", chapterSource,
+		"-c", "copy",
+		output,
+	}
+}
+
+// BuildFFMetadata renders tags and chapters in ffmpeg's ffmetadata format.
+// Chapters must have their end times filled in.
+func BuildFFMetadata(tags map[string]string, chapters []models.Chapter) string {
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s=%s\n", escapeFFMetadata(key), escapeFFMetadata(tags[key]))
+	}
+
+	for _, chapter := range chapters {
+		b.WriteString("\n[CHAPTER]\n")
+		b.WriteString("TIMEBASE=1/1000\n")
+		fmt.Fprintf(&b, "START=%d\n", int64(chapter.Start*1000+0.5))
+		fmt.Fprintf(&b, "END=%d\n", int64(chapter.End*1000+0.5))
+		if chapter.Title != "" {
+			fmt.Fprintf(&b, "title=%s\n", escapeFFMetadata(chapter.Title))
+		}
+	}
+
+	return b.String()
+}
+
+// escapeFFMetadata escapes the characters that are special in ffmetadata
+// keys and values.
+func escapeFFMetadata(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		"=", `\=`,
+		";", `\;`,
+		"#", `\#`,
+		"\n", "\\\n",
+	).Replace(s)
+}
+
+// checkChapters rejects chapters that start at or after the end of the
+// input, and a last chapter without an end time when the input's length is
+// not known to end it.
+func checkChapters(p Params, info *models.FileInfo) error {
+	chapters, err := metadataChapters(p)
+	if err != nil || len(chapters) == 0 {
+		return err
+	}
+
+	var errs fieldErrors
+	for i, chapter := range chapters {
+		if info.Duration > 0 && chapter.Start >= info.Duration {
+			errs.add("chapters", "chapter %d starts at %.2f seconds, after the end of the input at %.2f seconds", i+1, chapter.Start, info.Duration)
+		}
+	}
+	if last := chapters[len(chapters)-1]; last.End == 0 && info.Duration <= 0 {
+		errs.add("chapters", "the last chapter needs an end time, since the input's length is unknown")
+	}
+	return errs.err()
+}
+
+// metadataChapters decodes the chapters parameter, filling in missing end
+// times from the start of the following chapter. The last chapter ends
+// with the input when it has no end time; its end stays zero while the
+// input's length is not known yet.
+func metadataChapters(p Params) ([]models.Chapter, error) {
+	var chapters []models.Chapter
+	if err := p.Decode("chapters", &chapters); err != nil {
+		return nil, err
+	}
+
+	for i := range chapters {
+		chapter := &chapters[i]
+		if chapter.Start < 0 {
+			return nil, fmt.Errorf("chapter %d starts before the beginning", i+1)
+		}
+		if i > 0 && chapter.Start < chapters[i-1].End {
+			return nil, fmt.Errorf("chapter %d starts before chapter %d ends", i+1, i)
+		}
+
+		if chapter.End == 0 {
+			if i < len(chapters)-1 {
+				chapter.End = chapters[i+1].Start
+			} else if duration := p.Float(inputDurationParam); duration > chapter.Start {
+				chapter.End = duration
+			} else {
+				continue
+			}
+		}
+		if chapter.End <= chapter.Start {
+			return nil, fmt.Errorf("chapter %d must end after it starts", i+1)
+		}
+	}
+
+	return chapters, nil
+}
+
+func hasMetadataTags(p Params) bool {
+	for _, field := range metadataFields {
+		if p.String(field) != "" {
+			return true
+		}
+	}
+	return false
+}
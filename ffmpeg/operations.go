@@ -2,14 +2,16 @@ package ffmpeg
 
 import (
 	"fmt"
-	"os/exec"
+	"os"
 	"runtime"
 	"strings"
+
+	"ffwd-ui/models"
 )
 
 func BuildTrimStartCommand(input, output string, seconds float64) []string {
 	return []string{
-		"-ss", fmt.Sprintf("%.2f", seconds),
+		"-ss", formatSeconds(seconds),
 		"-i", input,
 		"-c", "copy",
 		output,
@@ -19,7 +21,7 @@ func BuildTrimStartCommand(input, output string, seconds float64) []string {
 func BuildTrimToLengthCommand(input, output string, duration float64) []string {
 	return []string{
 		"-i", input,
-		"-t", fmt.Sprintf("%.2f", duration),
+		"-t", formatSeconds(duration),
 		"-c", "copy",
 		output,
 	}
@@ -56,33 +58,52 @@ func BuildConvertFormatCommand(input, output string) []string {
 	}
 }
 
+// BuildChangeResolutionCommand scales the video of input. With a hardware
+// encoder as hwAccel, the frames are uploaded to its device and scaled
+// there when its API has a scaler (see HardwareVideoArgs).
 func BuildChangeResolutionCommand(input, output string, width, height int, hwAccel string) []string {
-	var scale string
+	if hwAccel == "" || hwAccel == "none" {
+		return []string{"-i", input, "-vf", scaleFilter(width, height), "-c:a", "copy", output}
+	}
+
+	inputArgs, videoArgs := HardwareVideoArgs(hwAccel, nil, scaleSize(width, height))
+	args := append(inputArgs, "-i", input)
+	args = append(args, videoArgs...)
+	return append(args, "-c:a", "copy", output)
+}
+
+// scaleFilter returns the scale filter for a target size. A zero dimension
+// keeps the aspect ratio.
+func scaleFilter(width, height int) string {
+	return "scale=" + scaleSize(width, height)
+}
+
+// scaleSize returns the width:height of a scale filter for a target size.
+// A dimension left to the filter is rounded to even, which 4:2:0 video
+// needs.
+func scaleSize(width, height int) string {
 	if width > 0 && height > 0 {
-		scale = fmt.Sprintf("%d:%d", width, height)
+		return fmt.Sprintf("%d:%d", width, height)
 	} else if width > 0 {
-		scale = fmt.Sprintf("%d:-1", width)
+		return fmt.Sprintf("%d:-2", width)
 	} else if height > 0 {
-		scale = fmt.Sprintf("-1:%d", height)
-	} else {
-		scale = "1280:720"
+		return fmt.Sprintf("-2:%d", height)
 	}
+	return "1280:720"
+}
 
-	args := []string{"-i", input}
-
-	if hwAccel != "" && hwAccel != "none" {
-		args = append(args, "-c:v", hwAccel)
-	}
+func volumeFilter(volumePercent int) string {
+	return fmt.Sprintf("volume=%.2f", float64(volumePercent)/100.0)
+}
 
-	args = append(args, "-vf", fmt.Sprintf("scale=%s", scale), "-c:a", "copy", output)
-	return args
+func cropFilter(width, height, x, y int) string {
+	return fmt.Sprintf("crop=%d:%d:%d:%d", width, height, x, y)
 }
 
 func BuildAdjustVolumeCommand(input, output string, volumePercent int) []string {
-	volumeMultiplier := float64(volumePercent) / 100.0
 	return []string{
 		"-i", input,
-		"-af", fmt.Sprintf("volume=%.2f", volumeMultiplier),
+		"-af", volumeFilter(volumePercent),
 		"-c:v", "copy",
 		output,
 	}
@@ -90,8 +111,8 @@ func BuildAdjustVolumeCommand(input, output string, volumePercent int) []string
 
 func BuildTrimRangeCommand(input, output string, startSeconds, endSeconds float64) []string {
 	return []string{
-		"-ss", fmt.Sprintf("%.2f", startSeconds),
-		"-to", fmt.Sprintf("%.2f", endSeconds),
+		"-ss", formatSeconds(startSeconds),
+		"-to", formatSeconds(endSeconds),
 		"-i", input,
 		"-c", "copy",
 		output,
@@ -101,57 +122,67 @@ func BuildTrimRangeCommand(input, output string, startSeconds, endSeconds float6
 func BuildCropVideoCommand(input, output string, width, height, x, y int) []string {
 	return []string{
 		"-i", input,
-		"-vf", fmt.Sprintf("crop=%d:%d:%d:%d", width, height, x, y),
+		"-vf", cropFilter(width, height, x, y),
 		"-c:a", "copy",
 		output,
 	}
 }
 
-func BuildAdjustBitrateCommand(input, output string, videoBitrate, audioBitrate, hwAccel string, twoPass bool) []string {
-	args := []string{"-i", input}
+// BuildAdjustBitrateCommand returns the passes for a bitrate change. With
+// twoPass and a video bitrate, the first pass only analyses the video and
+// writes its statistics to a log file in WorkDir, which the second pass
+// reads while writing the output. NVENC does its multi-pass analysis inside
+// a single invocation, and the other hardware encoders do not support
+// two-pass at all, so both get a single pass.
+func BuildAdjustBitrateCommand(input, output string, videoBitrate, audioBitrate, hwAccel string, twoPass bool) [][]string {
+	hw := hwAccel != "" && hwAccel != "none"
 
+	var inputArgs, videoArgs []string
 	if videoBitrate != "" {
-		if hwAccel != "" && hwAccel != "none" {
-			args = append(args, "-c:v", hwAccel)
-		}
-		args = append(args, "-b:v", videoBitrate)
-
-		if twoPass {
-			args = append(args, "-pass", "1", "-f", "null")
+		if hw {
+			inputArgs, videoArgs = HardwareVideoArgs(hwAccel, nil, "")
 		}
+		videoArgs = append(videoArgs, "-b:v", videoBitrate)
 	} else {
-		args = append(args, "-c:v", "copy")
+		videoArgs = append(videoArgs, "-c:v", "copy")
+		twoPass = false
 	}
 
+	var audioArgs []string
 	if audioBitrate != "" {
-		args = append(args, "-b:a", audioBitrate)
+		audioArgs = append(audioArgs, "-b:a", audioBitrate)
 	} else {
-		args = append(args, "-c:a", "copy")
+		audioArgs = append(audioArgs, "-c:a", "copy")
+	}
+
+	if twoPass && hw {
+		if strings.HasSuffix(hwAccel, "_nvenc") {
+			videoArgs = append(videoArgs, "-multipass", "fullres")
+		}
+		twoPass = false
 	}
 
 	if !twoPass {
+		args := append(inputArgs, "-i", input)
+		args = append(args, videoArgs...)
+		args = append(args, audioArgs...)
 		args = append(args, output)
+		return [][]string{args}
 	}
-	return args
-}
 
-func DetectHardwareEncoder() string {
-	// Try to detect available hardware encoders
-	encoders := []string{"h264_nvenc", "h264_qsv", "h264_videotoolbox", "h264_vaapi"}
+	passLog := WorkDir + "/passlog"
 
-	for _, encoder := range encoders {
-		cmd := exec.Command("ffmpeg", "-hide_banner", "-encoders")
-		output, err := cmd.Output()
-		if err != nil {
-			continue
-		}
+	first := []string{"-i", input}
+	first = append(first, videoArgs...)
+	first = append(first, "-pass", "1", "-passlogfile", passLog, "-an", "-f", "null", os.DevNull)
 
-		if strings.Contains(string(output), encoder) {
-			return encoder
-		}
-	}
+	second := []string{"-i", input}
+	second = append(second, videoArgs...)
+	second = append(second, "-pass", "2", "-passlogfile", passLog)
+	second = append(second, audioArgs...)
+	second = append(second, output)
 
-	return "none"
+	return [][]string{first, second}
 }
 
 func BuildAddPaddingCommand(input, output string, startSeconds, endSeconds float64) []string {
@@ -186,6 +217,43 @@ func BuildAddPaddingCommand(input, output string, startSeconds, endSeconds float
 	return args
 }
 
+// BuildSelectStreamsCommand copies the selected streams of input in the
+// given order. Every output stream gets an explicit disposition so that
+// only the selected streams are marked default or forced.
+func BuildSelectStreamsCommand(input, output string, streams []models.StreamSelection) []string {
+	args := []string{"-i", input}
+
+	for _, stream := range streams {
+		args = append(args, "-map", fmt.Sprintf("0:%d", stream.Index))
+	}
+
+	args = append(args, "-c", "copy")
+
+	for i, stream := range streams {
+		var disposition []string
+		if stream.Default {
+			disposition = append(disposition, "default")
+		}
+		if stream.Forced {
+			disposition = append(disposition, "forced")
+		}
+		if len(disposition) == 0 {
+			disposition = []string{"0"}
+		}
+		args = append(args, fmt.Sprintf("-disposition:%d", i), strings.Join(disposition, "+"))
+
+		if stream.Language != "" {
+			args = append(args, fmt.Sprintf("-metadata:s:%d", i), "language="+stream.Language)
+		}
+		if stream.Title != "" {
+			args = append(args, fmt.Sprintf("-metadata:s:%d", i), "title="+stream.Title)
+		}
+	}
+
+	args = append(args, output)
+	return args
+}
+
 func BuildCommandString(args []string) string {
 	quotedArgs := make([]string, len(args))
 	for i, arg := range args {
@@ -194,6 +262,16 @@ func BuildCommandString(args []string) string {
 	return "ffmpeg " + strings.Join(quotedArgs, " ")
 }
 
+// BuildPassesString formats a multi-pass command for display, joining the
+// passes so they run one after another in a shell.
+func BuildPassesString(passes [][]string) string {
+	commands := make([]string, len(passes))
+	for i, args := range passes {
+		commands[i] = BuildCommandString(args)
+	}
+	return strings.Join(commands, " && ")
+}
+
 func quoteArg(arg string) string {
 	// Check if argument needs quoting
 	needsQuote := strings.ContainsAny(arg, " \t\n'\"()[]{}$&|;<>~`#*?")
@@ -0,0 +1,39 @@
+package ffmpeg
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestScaleSize(t *testing.T) {
+	tests := []struct {
+		width, height int
+		want          string
+	}{
+		{1280, 720, "1280:720"},
+		{640, 0, "640:-2"},
+		{0, 480, "-2:480"},
+		{0, 0, "1280:720"},
+	}
+	for _, tt := range tests {
+		if got := scaleSize(tt.width, tt.height); got != tt.want {
+			t.Errorf("scaleSize(%d, %d) = %q, want %q", tt.width, tt.height, got, tt.want)
+		}
+	}
+}
+
+func TestBuildChangeResolutionCommand(t *testing.T) {
+	tests := []struct {
+		hwAccel string
+		want    []string
+	}{
+		{"", []string{"-i", "in.mp4", "-vf", "scale=640:-2", "-c:a", "copy", "out.mp4"}},
+		{"none", []string{"-i", "in.mp4", "-vf", "scale=640:-2", "-c:a", "copy", "out.mp4"}},
+	}
+	for _, tt := range tests {
+		got := BuildChangeResolutionCommand("in.mp4", "out.mp4", 640, 0, tt.hwAccel)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("hw_accel %q: got %q, want %q", tt.hwAccel, got, tt.want)
+		}
+	}
+}
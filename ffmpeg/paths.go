@@ -0,0 +1,171 @@
+package ffmpeg
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// outputMuxers maps the output extensions ffmpeg recognises to the muxer
+// it picks for them.
+var outputMuxers = map[string]string{
+	".3gp":  "3gp",
+	".aac":  "adts",
+	".ac3":  "ac3",
+	".aiff": "aiff",
+	".amr":  "amr",
+	".avi":  "avi",
+	".caf":  "caf",
+	".dv":   "dv",
+	".f4v":  "f4v",
+	".flac": "flac",
+	".flv":  "flv",
+	".gif":  "gif",
+	".m2ts": "mpegts",
+	".m4a":  "ipod",
+	".m4b":  "ipod",
+	".m4v":  "ipod",
+	".mka":  "matroska",
+	".mkv":  "matroska",
+	".mov":  "mov",
+	".mp2":  "mp2",
+	".mp3":  "mp3",
+	".mp4":  "mp4",
+	".mpeg": "mpeg",
+	".mpg":  "mpeg",
+	".mts":  "mpegts",
+	".mxf":  "mxf",
+	".nut":  "nut",
+	".oga":  "ogg",
+	".ogg":  "ogg",
+	".ogv":  "ogg",
+	".opus": "opus",
+	".ts":   "mpegts",
+	".vob":  "vob",
+	".wav":  "wav",
+	".webm": "webm",
+	".wv":   "wv",
+	".wma":  "asf",
+	".wmv":  "asf",
+}
+
+// SafePath returns path in a form ffmpeg reads as a file name. A relative
+// path starting with "-" would be taken for an option, and one with a colon
+// before its first slash, such as "take:2.mp4", for a protocol. Both get
+// "./" in front, which unlike the file: protocol leaves a path the rest of
+// the app can open too. Other paths are returned as they are.
+func SafePath(path string) string {
+	if path == "" || filepath.IsAbs(path) || filepath.VolumeName(path) != "" {
+		return path
+	}
+	first, _, _ := strings.Cut(filepath.ToSlash(path), "/")
+	if strings.HasPrefix(path, "-") || strings.Contains(first, ":") {
+		return "." + string(filepath.Separator) + path
+	}
+	return path
+}
+
+// CheckPaths is run before the commands of an operation are built. It
+// rejects an output that is the same file as one of the inputs, after
+// resolving symbolic links, an output directory that cannot be written to
+// and an output extension ffmpeg cannot write. It returns input and output
+// made safe with SafePath.
+func (op *Operation) CheckPaths(input, output string, p Params) (string, string, error) {
+	if output == "" {
+		return "", "", fmt.Errorf("no output file")
+	}
+
+	inputs := []string{input}
+	if op.Inputs != nil {
+		inputs = append(inputs, op.Inputs(p)...)
+	}
+	for _, in := range inputs {
+		if samePath(in, output) {
+			return "", "", fmt.Errorf("the output %s would overwrite the input %s", output, in)
+		}
+	}
+
+	if err := checkWritable(filepath.Dir(output)); err != nil {
+		return "", "", err
+	}
+	if err := checkMuxer(output); err != nil {
+		return "", "", err
+	}
+	return SafePath(input), SafePath(output), nil
+}
+
+// samePath reports whether a and b name the same file, through symbolic
+// or hard links. An output that does not exist yet is compared by the
+// resolved path it would be created at.
+func samePath(a, b string) bool {
+	if resolvePath(a) == resolvePath(b) {
+		return true
+	}
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
+
+// resolvePath returns the absolute path of path with every symbolic link
+// resolved, resolving only the directory when path does not exist.
+func resolvePath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved
+	}
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(abs)); err == nil {
+		return filepath.Join(dir, filepath.Base(abs))
+	}
+	return abs
+}
+
+// checkWritable creates and removes a file in dir, which catches read-only
+// mounts and access control lists that the permission bits do not show.
+func checkWritable(dir string) error {
+	info, err := os.Stat(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("the output folder %s does not exist", dir)
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a folder", dir)
+	}
+
+	file, err := os.CreateTemp(dir, ".ffwd-write-*")
+	if err != nil {
+		return fmt.Errorf("cannot write to the output folder %s: %w", dir, errors.Unwrap(err))
+	}
+	file.Close()
+	os.Remove(file.Name())
+	return nil
+}
+
+// checkMuxer checks that ffmpeg can tell the format to write from the
+// output's extension and, when the muxers of the located build are known,
+// that it was built with that muxer.
+func checkMuxer(output string) error {
+	ext := strings.ToLower(filepath.Ext(output))
+	if ext == "" {
+		return fmt.Errorf("the output %s needs a file extension such as .mp4 or .mkv", output)
+	}
+	muxer, ok := outputMuxers[ext]
+	if !ok {
+		return fmt.Errorf("ffmpeg cannot write %s files", ext)
+	}
+
+	toolchainMu.Lock()
+	muxers := buildMuxers
+	toolchainMu.Unlock()
+	if muxers != nil && !muxers[muxer] {
+		return fmt.Errorf("this ffmpeg build lacks the %s muxer for %s files", muxer, ext)
+	}
+	return nil
+}
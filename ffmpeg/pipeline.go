@@ -0,0 +1,238 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"strings"
+
+	"ffwd-ui/models"
+)
+
+func init() {
+	RegisterOperation(&Operation{
+		Name:  "pipeline",
+		Label: "Pipeline",
+		Params: []ParamSpec{
+			{Name: "steps", Label: "Steps", Type: ParamList, Required: true},
+		},
+		OutputSuffix: "_processed",
+		Validate: func(p Params) error {
+			_, err := pipelineSteps(p)
+			return err
+		},
+		Build: func(input, output string, p Params) [][]string {
+			steps, _ := pipelineSteps(p)
+			passes, _ := buildPipeline(input, output, steps)
+			return passes
+		},
+		Durations: func(p Params, inputDuration float64) []float64 {
+			steps, _ := pipelineSteps(p)
+			return pipelineDurations(steps, inputDuration)
+		},
+		// Only the first step sees the original input. Pipelines do not
+		// plan their steps, so only its check runs.
+		CheckInput: func(p Params, info *models.FileInfo) error {
+			steps, err := pipelineSteps(p)
+			if err != nil {
+				return err
+			}
+			first := steps[0]
+			if first.op.CheckInput == nil {
+				return nil
+			}
+			if err := first.op.CheckInput(first.params, info); err != nil {
+				return fmt.Errorf("%s: %w", first.op.Name, err)
+			}
+			return nil
+		},
+		Plan: func(p Params, info *models.FileInfo, output string) (float64, error) {
+			p[inputDurationParam] = info.Duration
+			return info.Duration, nil
+		},
+		Files: func(input string, p Params) map[string]string {
+			steps, _ := pipelineSteps(p)
+			inputs, _ := stepPaths(input, "", steps)
+			files := make(map[string]string)
+			duration := p.Float(inputDurationParam)
+			for i, step := range steps {
+				if duration > 0 {
+					step.params[inputDurationParam] = duration
+				}
+				for name, content := range step.op.WorkFiles(inputs[i], step.params) {
+					files[stepFileName(i, name)] = content
+				}
+				duration = step.op.OutputDuration(step.params, duration)
+			}
+			return files
+		},
+	})
+}
+
+// pipelineStep is a models.PipelineStep resolved against its operation.
+type pipelineStep struct {
+	op     *Operation
+	params Params
+}
+
+// pipelineSteps decodes and resolves the steps parameter of a pipeline.
+func pipelineSteps(p Params) ([]pipelineStep, error) {
+	var raw []models.PipelineStep
+	if err := p.Decode("steps", &raw); err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("add at least one step")
+	}
+
+	steps := make([]pipelineStep, len(raw))
+	for i, step := range raw {
+		if step.Operation == "pipeline" {
+			return nil, fmt.Errorf("step %d: pipelines cannot be nested", i+1)
+		}
+		op, err := LookupOperation(step.Operation)
+		if err != nil {
+			return nil, fmt.Errorf("step %d: %w", i+1, err)
+		}
+		if op.Standalone {
+			return nil, fmt.Errorf("step %d: %s cannot be part of a pipeline", i+1, op.Label)
+		}
+		params, err := op.Resolve(step.Params)
+		if err != nil {
+			return nil, fmt.Errorf("step %d: %w", i+1, err)
+		}
+		steps[i] = pipelineStep{op: op, params: params}
+	}
+	return steps, nil
+}
+
+// buildPipeline returns the passes that run steps on input in order and
+// write the result to output. When every step can be expressed as filters
+// (see Operation.Chain), the steps are merged into a single ffmpeg command
+// with combined -vf and -af chains. Otherwise each step runs its own
+// command and hands its output to the next through a file in WorkDir,
+// where each step's own work files are prefixed with the step number.
+// Intermediate files are Matroska, which can hold whatever streams a step
+// copies, unless the step has an output extension of its own.
+//
+// counts holds the number of passes each step contributed, or is nil when
+// the steps were merged.
+func buildPipeline(input, output string, steps []pipelineStep) (passes [][]string, counts []int) {
+	if segment, ok := mergeSteps(steps); ok {
+		return [][]string{segment.command(input, output)}, nil
+	}
+
+	inputs, outputs := stepPaths(input, output, steps)
+	for i, step := range steps {
+		stepPasses := step.op.Build(inputs[i], outputs[i], step.params)
+		for name := range step.op.WorkFiles(inputs[i], step.params) {
+			renameWorkFile(stepPasses, name, stepFileName(i, name))
+		}
+		passes = append(passes, stepPasses...)
+		counts = append(counts, len(stepPasses))
+	}
+	return passes, counts
+}
+
+// stepPaths returns the input and output of each step when the steps run
+// one after another.
+func stepPaths(input, output string, steps []pipelineStep) (inputs, outputs []string) {
+	for i, step := range steps {
+		stepOutput := output
+		if i < len(steps)-1 {
+			stepExt := ".mkv"
+			if step.op.OutputExt != "" {
+				stepExt = step.op.OutputExt
+			}
+			stepOutput = fmt.Sprintf("%s/step%d%s", WorkDir, i+1, stepExt)
+		}
+
+		inputs = append(inputs, input)
+		outputs = append(outputs, stepOutput)
+		input = stepOutput
+	}
+	return inputs, outputs
+}
+
+func stepFileName(index int, name string) string {
+	return fmt.Sprintf("step%d-%s", index+1, name)
+}
+
+// renameWorkFile rewrites references to a file in WorkDir.
+func renameWorkFile(passes [][]string, from, to string) {
+	for _, args := range passes {
+		for i, arg := range args {
+			args[i] = strings.ReplaceAll(arg, WorkDir+"/"+from, WorkDir+"/"+to)
+		}
+	}
+}
+
+// pipelineDurations returns the output length of each pass of the pipeline,
+// following the input length through every step.
+func pipelineDurations(steps []pipelineStep, inputDuration float64) []float64 {
+	_, counts := buildPipeline("", "", steps)
+
+	duration := inputDuration
+	if counts == nil {
+		for _, step := range steps {
+			duration = step.op.OutputDuration(step.params, duration)
+		}
+		return []float64{duration}
+	}
+
+	var durations []float64
+	for i, step := range steps {
+		durations = append(durations, step.op.PassDurations(step.params, duration, counts[i])...)
+		duration = step.op.OutputDuration(step.params, duration)
+	}
+	return durations
+}
+
+// mergeSteps combines the chain segments of steps. It fails when a step has
+// no segment, or when more than one step needs input options, since two
+// seeks cannot be expressed on one input. A single step is left to its own
+// command.
+func mergeSteps(steps []pipelineStep) (*ChainSegment, bool) {
+	if len(steps) < 2 {
+		return nil, false
+	}
+
+	merged := &ChainSegment{}
+	for _, step := range steps {
+		if step.op.Chain == nil {
+			return nil, false
+		}
+		segment := step.op.Chain(step.params)
+		if segment == nil {
+			return nil, false
+		}
+		if len(segment.InputArgs) > 0 {
+			if len(merged.InputArgs) > 0 {
+				return nil, false
+			}
+			merged.InputArgs = segment.InputArgs
+		}
+		merged.VideoFilters = append(merged.VideoFilters, segment.VideoFilters...)
+		merged.AudioFilters = append(merged.AudioFilters, segment.AudioFilters...)
+	}
+	return merged, true
+}
+
+// command returns a single ffmpeg invocation for the segment. Streams
+// without filters are copied.
+func (s *ChainSegment) command(input, output string) []string {
+	args := append([]string{}, s.InputArgs...)
+	args = append(args, "-i", input)
+
+	if len(s.VideoFilters) > 0 {
+		args = append(args, "-vf", strings.Join(s.VideoFilters, ","))
+	} else {
+		args = append(args, "-c:v", "copy")
+	}
+
+	if len(s.AudioFilters) > 0 {
+		args = append(args, "-af", strings.Join(s.AudioFilters, ","))
+	} else {
+		args = append(args, "-c:a", "copy")
+	}
+
+	return append(args, output)
+}
@@ -3,38 +3,78 @@ package ffmpeg
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"os/exec"
+	"sort"
 	"strconv"
+	"strings"
 
 	"ffwd-ui/models"
 )
 
 type FFProbeOutput struct {
-	Format  FFProbeFormat   `json:"format"`
-	Streams []FFProbeStream `json:"streams"`
+	Format   FFProbeFormat    `json:"format"`
+	Streams  []FFProbeStream  `json:"streams"`
+	Chapters []FFProbeChapter `json:"chapters"`
 }
 
 type FFProbeFormat struct {
-	Filename   string `json:"filename"`
-	Size       string `json:"size"`
-	Duration   string `json:"duration"`
-	FormatName string `json:"format_name"`
+	Filename   string            `json:"filename"`
+	Size       string            `json:"size"`
+	Duration   string            `json:"duration"`
+	StartTime  string            `json:"start_time"`
+	FormatName string            `json:"format_name"`
+	BitRate    string            `json:"bit_rate"`
+	Tags       map[string]string `json:"tags"`
 }
 
 type FFProbeStream struct {
-	CodecType string `json:"codec_type"`
-	CodecName string `json:"codec_name"`
-	Width     int    `json:"width"`
-	Height    int    `json:"height"`
+	Index          int               `json:"index"`
+	CodecType      string            `json:"codec_type"`
+	CodecName      string            `json:"codec_name"`
+	CodecLongName  string            `json:"codec_long_name"`
+	Profile        string            `json:"profile"`
+	Level          int               `json:"level"`
+	TimeBase       string            `json:"time_base"`
+	Width          int               `json:"width"`
+	Height         int               `json:"height"`
+	PixFmt         string            `json:"pix_fmt"`
+	ColorSpace     string            `json:"color_space"`
+	ColorTransfer  string            `json:"color_transfer"`
+	ColorPrimaries string            `json:"color_primaries"`
+	ColorRange     string            `json:"color_range"`
+	RFrameRate     string            `json:"r_frame_rate"`
+	AvgFrameRate   string            `json:"avg_frame_rate"`
+	SampleRate     string            `json:"sample_rate"`
+	Channels       int               `json:"channels"`
+	ChannelLayout  string            `json:"channel_layout"`
+	BitRate        string            `json:"bit_rate"`
+	Duration       string            `json:"duration"`
+	Disposition    map[string]int    `json:"disposition"`
+	Tags           map[string]string `json:"tags"`
+	SideDataList   []FFProbeSideData `json:"side_data_list"`
+}
+
+type FFProbeSideData struct {
+	SideDataType string  `json:"side_data_type"`
+	Rotation     float64 `json:"rotation"`
+}
+
+type FFProbeChapter struct {
+	ID        int64             `json:"id"`
+	StartTime string            `json:"start_time"`
+	EndTime   string            `json:"end_time"`
+	Tags      map[string]string `json:"tags"`
 }
 
 func ProbeFile(path string) (*models.FileInfo, error) {
-	cmd := exec.Command("ffprobe",
+	cmd := exec.Command(ffprobeBinary(),
 		"-v", "quiet",
 		"-print_format", "json",
 		"-show_format",
 		"-show_streams",
+		"-show_chapters",
 		path,
 	)
 
@@ -49,8 +89,12 @@ func ProbeFile(path string) (*models.FileInfo, error) {
 	}
 
 	fileInfo := &models.FileInfo{
-		Path:   path,
-		Format: probe.Format.FormatName,
+		Path:     path,
+		Format:   probe.Format.FormatName,
+		Bitrate:  parseInt(probe.Format.BitRate),
+		Tags:     probe.Format.Tags,
+		Streams:  make([]models.StreamInfo, 0, len(probe.Streams)),
+		Chapters: make([]models.Chapter, 0, len(probe.Chapters)),
 	}
 
 	if size, err := strconv.ParseInt(probe.Format.Size, 10, 64); err == nil {
@@ -61,19 +105,230 @@ func ProbeFile(path string) (*models.FileInfo, error) {
 		fileInfo.Duration = duration
 	}
 
+	if start, err := strconv.ParseFloat(probe.Format.StartTime, 64); err == nil {
+		fileInfo.StartTime = start
+	}
+
 	stat, err := os.Stat(path)
 	if err == nil {
 		fileInfo.Size = stat.Size()
 	}
 
 	for _, stream := range probe.Streams {
-		if stream.CodecType == "video" {
-			fileInfo.Codec = stream.CodecName
-			fileInfo.Width = stream.Width
-			fileInfo.Height = stream.Height
+		fileInfo.Streams = append(fileInfo.Streams, stream.info())
+	}
+
+	for _, chapter := range probe.Chapters {
+		start, _ := strconv.ParseFloat(chapter.StartTime, 64)
+		end, _ := strconv.ParseFloat(chapter.EndTime, 64)
+		fileInfo.Chapters = append(fileInfo.Chapters, models.Chapter{
+			Start: start,
+			End:   end,
+			Title: tag(chapter.Tags, "title"),
+		})
+	}
+
+	if stream := mainVideoStream(fileInfo); stream != nil {
+		fileInfo.Codec = stream.Codec
+		fileInfo.Width = stream.Width
+		fileInfo.Height = stream.Height
+	}
+
+	return fileInfo, nil
+}
+
+type ffprobePackets struct {
+	Packets []struct {
+		PTSTime string `json:"pts_time"`
+		Flags   string `json:"flags"`
+	} `json:"packets"`
+}
+
+// ProbeKeyframes returns the times of the keyframes of info's main video
+// stream from the last one at or before from up to to, in ascending order.
+// A to of zero or less reads to the end of the file. Times are relative to
+// the start of the file, as -ss expects them, and are exact so that they
+// can be passed back to ffmpeg as cut points.
+func ProbeKeyframes(info *models.FileInfo, from, to float64) ([]float64, error) {
+	stream := mainVideoStream(info)
+	if stream == nil {
+		return nil, fmt.Errorf("%s has no video stream", info.Path)
+	}
+
+	args := []string{
+		"-v", "quiet",
+		"-print_format", "json",
+		"-select_streams", strconv.Itoa(stream.Index),
+		"-show_entries", "packet=pts_time,flags",
+	}
+	if from > 0 || to > 0 {
+		interval := formatSeconds(info.StartTime+from) + "%"
+		if to > 0 {
+			interval += formatSeconds(info.StartTime + to)
+		}
+		args = append(args, "-read_intervals", interval)
+	}
+	args = append(args, info.Path)
+
+	output, err := exec.Command(ffprobeBinary(), args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	var probe ffprobePackets
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+
+	var keyframes []float64
+	for _, packet := range probe.Packets {
+		if !strings.Contains(packet.Flags, "K") {
+			continue
+		}
+		pts, err := strconv.ParseFloat(packet.PTSTime, 64)
+		if err != nil {
+			continue
+		}
+		keyframes = append(keyframes, max(pts-info.StartTime, 0))
+	}
+	sort.Float64s(keyframes)
+
+	// Seeking lands on the keyframe before from, unless from is the first
+	// one; drop any earlier ones a coarse seek read as well.
+	for len(keyframes) > 1 && keyframes[1] <= from {
+		keyframes = keyframes[1:]
+	}
+	return keyframes, nil
+}
+
+func (s FFProbeStream) info() models.StreamInfo {
+	info := models.StreamInfo{
+		Index:           s.Index,
+		Type:            s.CodecType,
+		Codec:           s.CodecName,
+		CodecLongName:   s.CodecLongName,
+		Profile:         s.Profile,
+		Bitrate:         parseInt(s.BitRate),
+		Language:        tag(s.Tags, "language"),
+		Title:           tag(s.Tags, "title"),
+		Default:         s.Disposition["default"] == 1,
+		Forced:          s.Disposition["forced"] == 1,
+		AttachedPicture: s.Disposition["attached_pic"] == 1,
+		Tags:            s.Tags,
+	}
+
+	if duration, err := strconv.ParseFloat(s.Duration, 64); err == nil {
+		info.Duration = duration
+	}
+
+	switch s.CodecType {
+	case "video":
+		info.Width = s.Width
+		info.Height = s.Height
+		info.PixelFormat = s.PixFmt
+		info.TimeBase = s.TimeBase
+		if s.Level > 0 {
+			info.Level = s.Level
+		}
+		info.ColorSpace = s.ColorSpace
+		info.ColorTransfer = s.ColorTransfer
+		info.ColorPrimaries = s.ColorPrimaries
+		info.ColorRange = s.ColorRange
+		info.Rotation = s.rotation()
+
+		info.FrameRate = parseRate(s.AvgFrameRate)
+		if info.FrameRate == 0 {
+			info.FrameRate = parseRate(s.RFrameRate)
+		}
+	case "audio":
+		info.Channels = s.Channels
+		info.ChannelLayout = s.ChannelLayout
+		info.SampleRate = int(parseInt(s.SampleRate))
+	}
+
+	return info
+}
+
+// mainVideoStream returns the first video stream of info that is not cover
+// art, or nil if there is none.
+func mainVideoStream(info *models.FileInfo) *models.StreamInfo {
+	for i, stream := range info.Streams {
+		if stream.Type == "video" && !stream.AttachedPicture {
+			return &info.Streams[i]
+		}
+	}
+	return nil
+}
+
+// firstAudioStream returns the first audio stream of info, or nil if there
+// is none.
+func firstAudioStream(info *models.FileInfo) *models.StreamInfo {
+	for i, stream := range info.Streams {
+		if stream.Type == "audio" {
+			return &info.Streams[i]
+		}
+	}
+	return nil
+}
+
+// rotation returns how far the video must be turned clockwise for display,
+// in degrees from 0 to 270. Recent ffprobe versions report a display matrix
+// whose rotation is counter-clockwise; older ones set a "rotate" tag.
+func (s FFProbeStream) rotation() int {
+	degrees := 0.0
+	found := false
+
+	for _, side := range s.SideDataList {
+		if side.SideDataType == "Display Matrix" {
+			degrees = -side.Rotation
+			found = true
 			break
 		}
 	}
+	if !found {
+		if rotate, err := strconv.ParseFloat(tag(s.Tags, "rotate"), 64); err == nil {
+			degrees = rotate
+		}
+	}
 
-	return fileInfo, nil
+	normalized := int(math.Round(degrees)) % 360
+	if normalized < 0 {
+		normalized += 360
+	}
+	return normalized
+}
+
+// tag looks up an ffprobe tag. Matroska files use upper-case tag names.
+func tag(tags map[string]string, key string) string {
+	if value, ok := tags[key]; ok {
+		return value
+	}
+	for k, value := range tags {
+		if strings.EqualFold(k, key) {
+			return value
+		}
+	}
+	return ""
+}
+
+// parseRate parses an ffprobe rational such as "30000/1001". It returns 0
+// for "0/0" and other unknown rates.
+func parseRate(value string) float64 {
+	num, den, ok := strings.Cut(value, "/")
+	if !ok {
+		f, _ := strconv.ParseFloat(value, 64)
+		return f
+	}
+
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+func parseInt(value string) int64 {
+	n, _ := strconv.ParseInt(value, 10, 64)
+	return n
 }
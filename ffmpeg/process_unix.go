@@ -0,0 +1,18 @@
+//go:build linux || darwin
+
+package ffmpeg
+
+import (
+	"os"
+	"syscall"
+)
+
+const pauseSupported = true
+
+func suspendProcess(process *os.Process) error {
+	return process.Signal(syscall.SIGSTOP)
+}
+
+func resumeProcess(process *os.Process) error {
+	return process.Signal(syscall.SIGCONT)
+}
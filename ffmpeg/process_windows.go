@@ -0,0 +1,16 @@
+//go:build windows
+
+package ffmpeg
+
+import "os"
+
+// Windows has no signal to suspend a process with.
+const pauseSupported = false
+
+func suspendProcess(process *os.Process) error {
+	return ErrPauseUnsupported
+}
+
+func resumeProcess(process *os.Process) error {
+	return ErrPauseUnsupported
+}
@@ -0,0 +1,143 @@
+package ffmpeg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"ffwd-ui/models"
+)
+
+// progressArgs make ffmpeg write machine-readable key=value progress blocks
+// to stdout instead of the human-readable stats line on stderr.
+var progressArgs = []string{"-progress", "pipe:1", "-nostats"}
+
+// readProgress parses the -progress stream from r and calls emit once per
+// block. duration is the expected output length in seconds and may be zero
+// when unknown.
+func readProgress(r io.Reader, duration float64, emit func(models.ProgressUpdate)) {
+	var update models.ProgressUpdate
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "frame":
+			update.Frame, _ = strconv.ParseInt(value, 10, 64)
+		case "fps":
+			update.FPS, _ = strconv.ParseFloat(value, 64)
+		case "bitrate":
+			update.Bitrate, _ = strconv.ParseFloat(strings.TrimSuffix(value, "kbits/s"), 64)
+		case "total_size":
+			update.TotalSize, _ = strconv.ParseInt(value, 10, 64)
+		case "out_time_us":
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil {
+				update.OutTime = float64(us) / 1e6
+			}
+		case "out_time":
+			// Only used when out_time_us is missing or N/A.
+			if update.OutTime == 0 {
+				if seconds, ok := parseClock(value); ok {
+					update.OutTime = seconds
+				}
+			}
+		case "speed":
+			update.Speed, _ = strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+		case "progress":
+			finishProgress(&update, duration)
+			emit(update)
+			update = models.ProgressUpdate{}
+		}
+	}
+}
+
+func finishProgress(update *models.ProgressUpdate, duration float64) {
+	if duration > 0 {
+		elapsed := update.OutTime
+		if elapsed < 0 {
+			elapsed = 0
+		}
+
+		update.Percent = elapsed / duration * 100
+		if update.Percent > 100 {
+			update.Percent = 100
+		}
+
+		if update.Speed > 0 && elapsed < duration {
+			update.ETA = (duration - elapsed) / update.Speed
+		}
+	}
+
+	update.Message = progressMessage(update)
+}
+
+// scalePassProgress maps the progress of pass index (zero-based) of total
+// onto the whole operation, giving each pass a share in proportion to the
+// media it writes, so two passes of the same length report 0-50% and
+// 50-100%. Passes without durations count equally.
+func scalePassProgress(update *models.ProgressUpdate, index, total int, durations []float64) {
+	var done, sum float64
+	for i := 0; i < total; i++ {
+		if i < index {
+			done += passDuration(durations, i)
+		}
+		sum += passDuration(durations, i)
+	}
+	if sum > 0 {
+		update.Percent = (done*100 + passDuration(durations, index)*update.Percent) / sum
+	} else {
+		update.Percent = (float64(index)*100 + update.Percent) / float64(total)
+	}
+
+	if update.Speed > 0 {
+		for i := index + 1; i < total; i++ {
+			update.ETA += passDuration(durations, i) / update.Speed
+		}
+	}
+
+	update.Message = fmt.Sprintf("Pass %d/%d: %s", index+1, total, progressMessage(update))
+}
+
+func progressMessage(update *models.ProgressUpdate) string {
+	if update.Speed > 0 {
+		return fmt.Sprintf("Processing... %.1f%% (%.2fx)", update.Percent, update.Speed)
+	}
+	return fmt.Sprintf("Processing... %.1f%%", update.Percent)
+}
+
+// parseClock parses an ffmpeg [-]HH:MM:SS.micro timestamp. Hours may have
+// any number of digits.
+func parseClock(value string) (float64, bool) {
+	sign := 1.0
+	if strings.HasPrefix(value, "-") {
+		sign = -1
+		value = value[1:]
+	}
+
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+
+	hours, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0, false
+	}
+	minutes, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return 0, false
+	}
+	seconds, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return sign * (hours*3600 + minutes*60 + seconds), true
+}
@@ -0,0 +1,442 @@
+package ffmpeg
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"path/filepath"
+	"strconv"
+
+	"ffwd-ui/models"
+)
+
+type ParamType string
+
+const (
+	ParamNumber ParamType = "number"
+	ParamInt    ParamType = "int"
+	ParamString ParamType = "string"
+	ParamBool   ParamType = "bool"
+	ParamList   ParamType = "list" // JSON array; a string is parsed as JSON
+)
+
+// ParamSpec describes one parameter of an operation. The frontend renders
+// its form from these, and Resolve uses them to coerce and check values.
+// Aliases are extra flag names accepted by the command-line interface.
+type ParamSpec struct {
+	Name     string      `json:"name"`
+	Label    string      `json:"label"`
+	Type     ParamType   `json:"type"`
+	Default  interface{} `json:"default,omitempty"`
+	Required bool        `json:"required"`
+	Options  []string    `json:"options,omitempty"`
+	Min      *float64    `json:"min,omitempty"`
+	Max      *float64    `json:"max,omitempty"`
+	Aliases  []string    `json:"aliases,omitempty"`
+}
+
+// inputDurationParam is the parameter in which Plan hooks record the
+// length of the input for Build and Files, and in which pipelines pass
+// each step the length of the media it reads.
+const inputDurationParam = "input_duration"
+
+// Operation is a registered ffmpeg operation. Build receives parameters that
+// have already been resolved against Params and passed Validate, and returns
+// one argument list per ffmpeg invocation (see Executor.ExecutePasses).
+//
+// The remaining hooks are optional:
+//
+//   - Durations returns the output length of each pass for an input of the
+//     given length, for operations such as trims that change it; without it
+//     every pass is assumed to be as long as the input.
+//   - Chain returns the operation as filters that can be merged with other
+//     operations into one invocation by a pipeline, or nil when the
+//     parameters need a command of their own.
+//   - Files returns files the commands read from WorkDir, keyed by name
+//     (see Executor.SetWorkFiles).
+//   - CheckInput validates the parameters against the probed input before a
+//     job is queued, for checks Validate cannot make without it.
+//   - Plan completes the parameters from the probed input and the output
+//     path for operations whose command depends on them. It returns the
+//     length in seconds of the media the operation reads. See Prepare.
+//     Pipelines do not plan their steps, so Build must still work without
+//     it unless the operation is Standalone.
+//   - Retry checks the output once the passes have succeeded, after attempt
+//     runs of them. It adjusts p and returns true when the passes should be
+//     built and run again, and returns an error when the output is not
+//     acceptable. The output stays in place until the next run succeeds.
+//     See RetryPasses.
+//   - Fallback switches p from a hardware encoder to a software one after
+//     the passes failed. It returns false when p uses no hardware encoder.
+//     See FallbackPasses.
+//   - Estimate returns the expected size in bytes of an output seconds long
+//     for operations that re-encode; without it the output is assumed to
+//     keep the input's bitrate. See EstimateSize.
+//   - Inputs returns the files the operation reads besides its input, so
+//     that CheckPaths can keep the output from overwriting them.
+//
+// Standalone operations cannot be part of a pipeline.
+type Operation struct {
+	Name         string      `json:"name"`
+	Label        string      `json:"label"`
+	Params       []ParamSpec `json:"params"`
+	OutputSuffix string      `json:"output_suffix"`
+	OutputExt    string      `json:"output_ext,omitempty"`
+	Standalone   bool        `json:"standalone,omitempty"`
+
+	Validate   func(p Params) error                                                  `json:"-"`
+	Build      func(input, output string, p Params) [][]string                       `json:"-"`
+	Durations  func(p Params, inputDuration float64) []float64                       `json:"-"`
+	Chain      func(p Params) *ChainSegment                                          `json:"-"`
+	Files      func(input string, p Params) map[string]string                        `json:"-"`
+	CheckInput func(p Params, info *models.FileInfo) error                           `json:"-"`
+	Plan       func(p Params, info *models.FileInfo, output string) (float64, error) `json:"-"`
+	Retry      func(output string, p Params, attempt int) (bool, error)              `json:"-"`
+	Fallback   func(p Params) bool                                                   `json:"-"`
+	Estimate   func(p Params, info *models.FileInfo, seconds float64) float64        `json:"-"`
+	Inputs     func(p Params) []string                                               `json:"-"`
+}
+
+// ChainSegment is an operation expressed as parts of a single ffmpeg
+// command. InputArgs go before -i, such as the seek options of a trim.
+type ChainSegment struct {
+	InputArgs    []string
+	VideoFilters []string
+	AudioFilters []string
+}
+
+// Params holds resolved operation parameters keyed by ParamSpec.Name.
+type Params map[string]interface{}
+
+func (p Params) Float(name string) float64 {
+	v, _ := p[name].(float64)
+	return v
+}
+
+// Int returns an int parameter. Parameters read back from JSON, such as
+// those of a persisted job, hold their numbers as float64.
+func (p Params) Int(name string) int {
+	switch v := p[name].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+func (p Params) String(name string) string {
+	v, _ := p[name].(string)
+	return v
+}
+
+func (p Params) Bool(name string) bool {
+	v, _ := p[name].(bool)
+	return v
+}
+
+func (p Params) List(name string) []interface{} {
+	v, _ := p[name].([]interface{})
+	return v
+}
+
+// Decode unmarshals a list parameter into v, which should point to a slice
+// of a JSON-decodable type.
+func (p Params) Decode(name string, v interface{}) error {
+	data, err := json.Marshal(p.List(name))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parameter %q: %w", name, err)
+	}
+	return nil
+}
+
+var (
+	registry      = make(map[string]*Operation)
+	registryOrder []string
+)
+
+// RegisterOperation adds op to the registry. It panics if an operation with
+// the same name is already registered.
+func RegisterOperation(op *Operation) {
+	if _, exists := registry[op.Name]; exists {
+		panic(fmt.Sprintf("ffmpeg: operation %q registered twice", op.Name))
+	}
+	registry[op.Name] = op
+	registryOrder = append(registryOrder, op.Name)
+}
+
+func LookupOperation(name string) (*Operation, error) {
+	op, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown operation: %s", name)
+	}
+	return op, nil
+}
+
+// Operations returns every registered operation in registration order.
+func Operations() []*Operation {
+	ops := make([]*Operation, len(registryOrder))
+	for i, name := range registryOrder {
+		ops[i] = registry[name]
+	}
+	return ops
+}
+
+// Resolve fills in defaults, converts raw values (as decoded from JSON or
+// given as strings on a command line) to their declared types and runs the
+// operation's validation. Parameters that are missing or cannot be
+// converted are reported together as a *ValidationError.
+func (op *Operation) Resolve(raw map[string]interface{}) (Params, error) {
+	params := make(Params, len(op.Params))
+
+	var errs fieldErrors
+	for _, spec := range op.Params {
+		value, ok := raw[spec.Name]
+		if !ok || value == nil {
+			if spec.Required {
+				errs.add(spec.Name, "is required")
+				continue
+			}
+			value = spec.Default
+		}
+
+		converted, err := spec.convert(value)
+		if err != nil {
+			errs.add(spec.Name, "%v", err)
+			continue
+		}
+		params[spec.Name] = converted
+	}
+	if err := errs.err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op.Name, err)
+	}
+
+	if op.Validate != nil {
+		if err := op.Validate(params); err != nil {
+			return nil, fmt.Errorf("%s: %w", op.Name, err)
+		}
+	}
+
+	return params, nil
+}
+
+// PassDurations returns the output length in seconds of each of the n
+// passes of the operation for an input of inputDuration seconds.
+func (op *Operation) PassDurations(p Params, inputDuration float64, n int) []float64 {
+	var durations []float64
+	if op.Durations != nil {
+		durations = op.Durations(p, inputDuration)
+	}
+
+	last := inputDuration
+	if len(durations) > 0 {
+		last = durations[len(durations)-1]
+	}
+	for len(durations) < n {
+		durations = append(durations, last)
+	}
+	return durations[:n]
+}
+
+// OutputDuration returns the length in seconds of the operation's output
+// for an input of inputDuration seconds.
+func (op *Operation) OutputDuration(p Params, inputDuration float64) float64 {
+	if op.Durations == nil {
+		return inputDuration
+	}
+	durations := op.Durations(p, inputDuration)
+	if len(durations) == 0 {
+		return inputDuration
+	}
+	return durations[len(durations)-1]
+}
+
+// Prepare checks p against the probed input and lets the operation
+// complete p from it and the output path, so that Build produces the
+// command that will run. It returns the length in seconds of the media the
+// operation reads, which is the input's duration unless Plan says
+// otherwise.
+func (op *Operation) Prepare(p Params, info *models.FileInfo, output string) (float64, error) {
+	if op.CheckInput != nil {
+		if err := op.CheckInput(p, info); err != nil {
+			return 0, fmt.Errorf("%s: %w", op.Name, err)
+		}
+	}
+
+	if op.Plan == nil {
+		return info.Duration, nil
+	}
+	duration, err := op.Plan(p, info, output)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op.Name, err)
+	}
+	return duration, nil
+}
+
+// RetryPasses runs the Retry hook on a copy of p once the passes have
+// succeeded attempt times. It returns the adjusted parameters and the
+// passes to run again, or p and no passes when the output is fine.
+func (op *Operation) RetryPasses(input, output string, p Params, attempt int) (Params, [][]string, error) {
+	if op.Retry == nil {
+		return p, nil, nil
+	}
+
+	next := maps.Clone(p)
+	again, err := op.Retry(output, next, attempt)
+	if err != nil {
+		return p, nil, fmt.Errorf("%s: %w", op.Name, err)
+	}
+	if !again {
+		return p, nil, nil
+	}
+	return next, op.Build(input, output, next), nil
+}
+
+// FallbackPasses runs the Fallback hook on a copy of p once the passes
+// have failed. It returns the adjusted parameters and the passes to run
+// instead, or p and no passes when there is nothing to fall back to.
+func (op *Operation) FallbackPasses(input, output string, p Params) (Params, [][]string) {
+	if op.Fallback == nil {
+		return p, nil
+	}
+
+	next := maps.Clone(p)
+	if !op.Fallback(next) {
+		return p, nil
+	}
+	return next, op.Build(input, output, next)
+}
+
+// WorkFiles returns the files the operation's commands expect in WorkDir.
+func (op *Operation) WorkFiles(input string, p Params) map[string]string {
+	if op.Files == nil {
+		return nil
+	}
+	return op.Files(input, p)
+}
+
+// OutputName derives the default output path for inputPath.
+func (op *Operation) OutputName(inputPath string) string {
+	ext := filepath.Ext(inputPath)
+	base := inputPath[:len(inputPath)-len(ext)]
+
+	if op.OutputExt != "" {
+		ext = op.OutputExt
+	}
+	return base + op.OutputSuffix + ext
+}
+
+func (spec ParamSpec) convert(value interface{}) (interface{}, error) {
+	var converted interface{}
+
+	switch spec.Type {
+	case ParamNumber, ParamInt:
+		var f float64
+		switch v := value.(type) {
+		case float64:
+			f = v
+		case int:
+			f = float64(v)
+		case string:
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("must be a number, got %q", v)
+			}
+			f = parsed
+		default:
+			return nil, fmt.Errorf("must be a number")
+		}
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("must be a finite number")
+		}
+
+		if spec.Min != nil && f < *spec.Min {
+			return nil, fmt.Errorf("must be at least %g", *spec.Min)
+		}
+		if spec.Max != nil && f > *spec.Max {
+			return nil, fmt.Errorf("must be at most %g", *spec.Max)
+		}
+
+		if spec.Type == ParamInt {
+			if f != float64(int(f)) {
+				return nil, fmt.Errorf("must be a whole number")
+			}
+			converted = int(f)
+		} else {
+			converted = f
+		}
+	case ParamString:
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("must be a string")
+		}
+		converted = s
+	case ParamBool:
+		switch v := value.(type) {
+		case bool:
+			converted = v
+		case string:
+			parsed, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("must be true or false, got %q", v)
+			}
+			converted = parsed
+		default:
+			return nil, fmt.Errorf("must be true or false")
+		}
+	case ParamList:
+		list, err := toList(value)
+		if err != nil {
+			return nil, fmt.Errorf("must be a list: %w", err)
+		}
+		converted = list
+	default:
+		return nil, fmt.Errorf("has unknown type %q", spec.Type)
+	}
+
+	if len(spec.Options) > 0 {
+		s := fmt.Sprint(converted)
+		for _, option := range spec.Options {
+			if option == s {
+				return converted, nil
+			}
+		}
+		return nil, fmt.Errorf("must be one of %v, got %q", spec.Options, s)
+	}
+
+	return converted, nil
+}
+
+// toList normalises a list value to []interface{} as encoding/json would
+// decode it, so resolved parameters look the same however they were given.
+func toList(value interface{}) ([]interface{}, error) {
+	var data []byte
+	if s, ok := value.(string); ok {
+		if s == "" {
+			return []interface{}{}, nil
+		}
+		data = []byte(s)
+	} else {
+		var err error
+		if data, err = json.Marshal(value); err != nil {
+			return nil, err
+		}
+	}
+
+	var list []interface{}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []interface{}{}
+	}
+	return list, nil
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
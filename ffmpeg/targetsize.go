@@ -0,0 +1,140 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"os"
+
+	"ffwd-ui/models"
+)
+
+const (
+	// bytesPerMB is the megabyte of target_size. Upload limits given in
+	// MiB are larger, so this errs on the small side.
+	bytesPerMB = 1000 * 1000
+
+	// containerOverhead is the share of a file taken by the container
+	// rather than the streams.
+	containerOverhead = 0.02
+
+	// minVideoKbps is the lowest video bitrate worth encoding at.
+	minVideoKbps = 50
+
+	// maxSizeAttempts is how many times target_size encodes before it
+	// gives up on reaching the target.
+	maxSizeAttempts = 3
+)
+
+func init() {
+	RegisterOperation(&Operation{
+		Name:  "target_size",
+		Label: "Fit to Size",
+		Params: []ParamSpec{
+			{Name: "target_size", Label: "Target size (MB)", Type: ParamNumber, Required: true, Min: floatPtr(0)},
+			{Name: "video_codec", Label: "Video codec", Type: ParamString, Default: "libx264", Options: []string{"libx264", "libvpx-vp9"}},
+			{Name: "audio_bitrate", Label: "Audio bitrate (kbit/s)", Type: ParamInt, Default: 128, Min: floatPtr(8)},
+		},
+		OutputSuffix: "_small",
+		Standalone:   true,
+		Validate: func(p Params) error {
+			if p.Float("target_size") <= 0 {
+				return fmt.Errorf("target_size must be greater than zero")
+			}
+			return nil
+		},
+		Plan:  planTargetSize,
+		Retry: retryTargetSize,
+		Estimate: func(p Params, info *models.FileInfo, seconds float64) float64 {
+			return p.Float("target_size") * bytesPerMB
+		},
+		Build: func(input, output string, p Params) [][]string {
+			return BuildTargetSizeCommand(input, output, p.String("video_codec"), int(p.Float("video_kbps")), int(p.Float("audio_kbps")))
+		},
+	})
+}
+
+// BuildTargetSizeCommand returns the two passes of an average-bitrate
+// encode at videoKbps and audioKbps. The first pass writes its statistics
+// to a log file in WorkDir for the second. A zero audioKbps drops the
+// audio.
+func BuildTargetSizeCommand(input, output, videoCodec string, videoKbps, audioKbps int) [][]string {
+	videoArgs := []string{"-c:v", videoCodec, "-b:v", fmt.Sprintf("%dk", videoKbps)}
+	passLog := WorkDir + "/passlog"
+
+	first := []string{"-i", input}
+	first = append(first, videoArgs...)
+	first = append(first, "-pass", "1", "-passlogfile", passLog, "-an", "-f", "null", os.DevNull)
+
+	second := []string{"-i", input}
+	second = append(second, videoArgs...)
+	second = append(second, "-pass", "2", "-passlogfile", passLog)
+	if audioKbps > 0 {
+		audioCodec := "aac"
+		if videoCodec == "libvpx-vp9" {
+			audioCodec = "libopus"
+		}
+		second = append(second, "-c:a", audioCodec, "-b:a", fmt.Sprintf("%dk", audioKbps))
+	} else {
+		second = append(second, "-an")
+	}
+	second = append(second, output)
+
+	return [][]string{first, second}
+}
+
+// planTargetSize splits the bitrate that fits the target size over the
+// input's duration between video and audio. The audio keeps its own
+// bitrate when that is lower than audio_bitrate.
+func planTargetSize(p Params, info *models.FileInfo, output string) (float64, error) {
+	if info.Duration <= 0 {
+		return 0, fmt.Errorf("the input's duration is unknown")
+	}
+
+	audioKbps := 0
+	if audio := firstAudioStream(info); audio != nil {
+		audioKbps = p.Int("audio_bitrate")
+		if audio.Bitrate > 0 && int(audio.Bitrate/1000) < audioKbps {
+			audioKbps = int(audio.Bitrate / 1000)
+		}
+	}
+
+	totalKbps := p.Float("target_size") * bytesPerMB * 8 / 1000 / info.Duration
+	videoKbps := totalKbps*(1-containerOverhead) - float64(audioKbps)
+	if videoKbps < minVideoKbps {
+		needed := (minVideoKbps + float64(audioKbps)) / (1 - containerOverhead) * 1000 / 8 * info.Duration / bytesPerMB
+		return 0, fmt.Errorf("%.1f MB is too small for %.0f seconds of video; it needs at least %.1f MB", p.Float("target_size"), info.Duration, needed)
+	}
+
+	p["video_kbps"] = videoKbps
+	p["audio_kbps"] = float64(audioKbps)
+	return info.Duration, nil
+}
+
+// retryTargetSize lowers the video bitrate by the share the output
+// overshot the target by, with a margin. The output is left in place: the
+// next attempt writes to a temporary file that replaces it only once the
+// attempt succeeds.
+func retryTargetSize(output string, p Params, attempt int) (bool, error) {
+	stat, err := os.Stat(output)
+	if err != nil {
+		return false, err
+	}
+
+	target := p.Float("target_size") * bytesPerMB
+	size := float64(stat.Size())
+	if size <= target {
+		return false, nil
+	}
+	if attempt >= maxSizeAttempts {
+		return false, fmt.Errorf("the output is %.1f MB, over the %.1f MB target after %d attempts", size/bytesPerMB, p.Float("target_size"), attempt)
+	}
+
+	audioKbps := p.Float("audio_kbps")
+	totalKbps := (p.Float("video_kbps") + audioKbps) * target / size * 0.97
+	videoKbps := totalKbps - audioKbps
+	if videoKbps < minVideoKbps {
+		return false, fmt.Errorf("the output is %.1f MB and cannot be made to fit %.1f MB", size/bytesPerMB, p.Float("target_size"))
+	}
+
+	p["video_kbps"] = videoKbps
+	return true, nil
+}
@@ -14,7 +14,7 @@ func ExtractThumbnail(inputPath string) (string, error) {
 	outputPath := filepath.Join(tmpDir, fmt.Sprintf("ffwd_thumb_%d.jpg", os.Getpid()))
 
 	// Extract frame at 1 second - use -ss after -i for better accuracy with some codecs
-	cmd := exec.Command("ffmpeg",
+	cmd := exec.Command(ffmpegBinary(),
 		"-i", inputPath,
 		"-ss", "00:00:01",
 		"-vframes", "1",
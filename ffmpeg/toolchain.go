@@ -0,0 +1,350 @@
+package ffmpeg
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"ffwd-ui/models"
+)
+
+// Environment variables that override the ffmpeg and ffprobe binaries when
+// the settings leave them empty.
+const (
+	FFmpegEnv  = "FFWD_FFMPEG"
+	FFprobeEnv = "FFWD_FFPROBE"
+)
+
+// Where a binary of the toolchain was found.
+const (
+	SourceSettings    = "settings"
+	SourceEnvironment = "environment"
+	SourceBundled     = "bundled"
+	SourcePath        = "path"
+	SourceMissing     = "missing"
+)
+
+var (
+	toolchainMu sync.Mutex
+	toolchain   = models.Toolchain{FFmpeg: "ffmpeg", FFprobe: "ffprobe"}
+
+	// buildEncoders, buildFilters and buildMuxers list what the located
+	// ffmpeg was built with. They are nil until LocateToolchain has read
+	// them, and then no command is checked against them.
+	buildEncoders map[string]bool
+	buildFilters  map[string]bool
+	buildMuxers   map[string]bool
+)
+
+// LocateToolchain finds the ffmpeg and ffprobe binaries that every command
+// runs from then on. Each is taken from its setting, a path that may be
+// empty, then from FFmpegEnv or FFprobeEnv, then from next to the running
+// executable, and last from PATH. It reads the version and build
+// configuration of ffmpeg and the encoders, filters and muxers it was
+// built with, and warns about operations that cannot run with it. Hardware
+// encoders are probed again on next use.
+func LocateToolchain(ffmpegSetting, ffprobeSetting string) models.Toolchain {
+	var warnings []string
+
+	chain := models.Toolchain{}
+	chain.FFmpeg, chain.FFmpegSource = locateBinary("ffmpeg", ffmpegSetting, FFmpegEnv, &warnings)
+	chain.FFprobe, chain.FFprobeSource = locateBinary("ffprobe", ffprobeSetting, FFprobeEnv, &warnings)
+
+	var encoders, filters, muxers map[string]bool
+	if chain.FFmpegSource != SourceMissing {
+		var err error
+		if chain.Version, err = readVersion(chain.FFmpeg); err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s -version failed: %v", chain.FFmpeg, err))
+		}
+		if chain.Configuration, err = readBuildConfiguration(chain.FFmpeg); err == nil {
+			chain.Libraries = enabledLibraries(chain.Configuration)
+		}
+		encoders, _ = readCapabilities(chain.FFmpeg, "-encoders")
+		filters, _ = readCapabilities(chain.FFmpeg, "-filters")
+		muxers, _ = readCapabilities(chain.FFmpeg, "-muxers")
+	}
+	if chain.FFprobeSource != SourceMissing {
+		if _, err := readVersion(chain.FFprobe); err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s -version failed: %v", chain.FFprobe, err))
+		}
+	}
+
+	toolchainMu.Lock()
+	toolchain = chain
+	buildEncoders, buildFilters, buildMuxers = encoders, filters, muxers
+	toolchainMu.Unlock()
+
+	hardwareMu.Lock()
+	hardwareProbed = false
+	hardwareMu.Unlock()
+
+	for _, op := range Operations() {
+		if missing := operationMissing(op); len(missing) > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s cannot run with this ffmpeg build: %s", op.Label, strings.Join(missing, ", ")))
+		}
+	}
+	chain.Warnings = warnings
+
+	toolchainMu.Lock()
+	toolchain.Warnings = warnings
+	toolchainMu.Unlock()
+	return chain
+}
+
+// CurrentToolchain returns the toolchain found by the last LocateToolchain,
+// or bare ffmpeg and ffprobe from PATH before it has run.
+func CurrentToolchain() models.Toolchain {
+	toolchainMu.Lock()
+	defer toolchainMu.Unlock()
+	return toolchain
+}
+
+func ffmpegBinary() string {
+	toolchainMu.Lock()
+	defer toolchainMu.Unlock()
+	return toolchain.FFmpeg
+}
+
+func ffprobeBinary() string {
+	toolchainMu.Lock()
+	defer toolchainMu.Unlock()
+	return toolchain.FFprobe
+}
+
+// CheckPasses returns an error naming the encoders and filters that passes
+// use and the located ffmpeg was not built with.
+func CheckPasses(passes [][]string) error {
+	if missing := missingCapabilities(passes); len(missing) > 0 {
+		return fmt.Errorf("this ffmpeg build lacks %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// operationMissing returns what op lacks with its default parameters.
+// Operations with required parameters are not checked until they are used.
+func operationMissing(op *Operation) []string {
+	params, err := op.Resolve(nil)
+	if err != nil {
+		return nil
+	}
+	return missingCapabilities(op.Build("input.mkv", "output.mkv", params))
+}
+
+func missingCapabilities(passes [][]string) []string {
+	toolchainMu.Lock()
+	encoders, filters := buildEncoders, buildFilters
+	toolchainMu.Unlock()
+
+	seen := make(map[string]bool)
+	var missing []string
+	add := func(kind, name string) {
+		if key := kind + " " + name; !seen[key] {
+			seen[key] = true
+			missing = append(missing, fmt.Sprintf("the %s %s", name, kind))
+		}
+	}
+
+	for _, args := range passes {
+		for i := 0; i+1 < len(args); i++ {
+			flag, value := args[i], args[i+1]
+			switch {
+			case isCodecFlag(flag):
+				if encoders != nil && value != "copy" && !encoders[value] {
+					add("encoder", value)
+				}
+			case isFilterFlag(flag):
+				if filters == nil {
+					continue
+				}
+				for _, name := range filterNames(value) {
+					if !filters[name] {
+						add("filter", name)
+					}
+				}
+			}
+		}
+	}
+	return missing
+}
+
+// isCodecFlag reports whether flag takes an encoder name, as -c:v, -acodec
+// or -codec:a:0 do.
+func isCodecFlag(flag string) bool {
+	switch flag {
+	case "-c", "-codec", "-vcodec", "-acodec", "-scodec":
+		return true
+	}
+	return strings.HasPrefix(flag, "-c:") || strings.HasPrefix(flag, "-codec:")
+}
+
+func isFilterFlag(flag string) bool {
+	switch flag {
+	case "-vf", "-af", "-filter_complex", "-lavfi":
+		return true
+	}
+	return strings.HasPrefix(flag, "-filter:")
+}
+
+// filterNames returns the names of the filters in a filter graph such as
+// "[0:v]scale=1280:-1[v];[v]format=nv12". Backslash-escaped separators in
+// filter arguments are skipped.
+func filterNames(graph string) []string {
+	var names []string
+	var filter strings.Builder
+	flush := func() {
+		name := strings.TrimSpace(filter.String())
+		for strings.HasPrefix(name, "[") {
+			end := strings.Index(name, "]")
+			if end < 0 {
+				break
+			}
+			name = strings.TrimSpace(name[end+1:])
+		}
+		if i := strings.IndexAny(name, "=[@"); i >= 0 {
+			name = name[:i]
+		}
+		if name != "" {
+			names = append(names, name)
+		}
+		filter.Reset()
+	}
+
+	quoted := false
+	for i := 0; i < len(graph); i++ {
+		switch c := graph[i]; {
+		case c == '\\' && i+1 < len(graph):
+			filter.WriteByte(c)
+			filter.WriteByte(graph[i+1])
+			i++
+		case c == '\'':
+			quoted = !quoted
+			filter.WriteByte(c)
+		case (c == ',' || c == ';') && !quoted:
+			flush()
+		default:
+			filter.WriteByte(c)
+		}
+	}
+	flush()
+	return names
+}
+
+// locateBinary resolves the binary called name and reports where it was
+// found. A setting or environment variable naming a file that does not
+// exist is skipped with a warning.
+func locateBinary(name, setting, env string, warnings *[]string) (string, string) {
+	if setting != "" {
+		if path, err := exec.LookPath(setting); err == nil {
+			return path, SourceSettings
+		}
+		*warnings = append(*warnings, fmt.Sprintf("the %s set in the settings, %s, is not an executable", name, setting))
+	}
+
+	if value := os.Getenv(env); value != "" {
+		if path, err := exec.LookPath(value); err == nil {
+			return path, SourceEnvironment
+		}
+		*warnings = append(*warnings, fmt.Sprintf("the %s set in %s, %s, is not an executable", name, env, value))
+	}
+
+	if executable, err := os.Executable(); err == nil {
+		file := name
+		if runtime.GOOS == "windows" {
+			file += ".exe"
+		}
+		bundled := filepath.Join(filepath.Dir(executable), file)
+		if info, err := os.Stat(bundled); err == nil && !info.IsDir() {
+			return bundled, SourceBundled
+		}
+	}
+
+	if path, err := exec.LookPath(name); err == nil {
+		return path, SourcePath
+	}
+
+	*warnings = append(*warnings, fmt.Sprintf("%s was not found; install FFmpeg or set its path in the settings", name))
+	return name, SourceMissing
+}
+
+// readVersion returns the version from the first line of binary -version,
+// such as "6.1.1" from "ffmpeg version 6.1.1 Copyright ...".
+func readVersion(binary string) (string, error) {
+	output, err := exec.Command(binary, "-hide_banner", "-version").Output()
+	if err != nil {
+		return "", err
+	}
+
+	line, _, _ := strings.Cut(string(output), "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 3 || fields[1] != "version" {
+		return "", fmt.Errorf("unexpected version line %q", line)
+	}
+	return fields[2], nil
+}
+
+// readBuildConfiguration returns the configure options binary was built
+// with.
+func readBuildConfiguration(binary string) ([]string, error) {
+	output, err := exec.Command(binary, "-hide_banner", "-buildconf").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var options []string
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); strings.HasPrefix(line, "--") {
+			options = append(options, line)
+		}
+	}
+	return options, nil
+}
+
+// enabledLibraries returns the external libraries a build configuration
+// enables, such as libx264 for --enable-libx264.
+func enabledLibraries(configuration []string) []string {
+	var libraries []string
+	for _, option := range configuration {
+		if library, ok := strings.CutPrefix(option, "--enable-"); ok && strings.HasPrefix(library, "lib") {
+			libraries = append(libraries, library)
+		}
+	}
+	sort.Strings(libraries)
+	return libraries
+}
+
+// readCapabilities returns the names listed by binary -encoders, -muxers
+// or -filters: one line per entry with its flags before its name. The
+// legends of -encoders and -muxers end in a line of dashes; that of
+// -filters has "=" where the name would be, which is harmless.
+func readCapabilities(binary, list string) (map[string]bool, error) {
+	output, err := exec.Command(binary, "-hide_banner", list).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	listing := list == "-filters"
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !listing {
+			listing = strings.HasPrefix(line, "--")
+			continue
+		}
+		if fields := strings.Fields(line); len(fields) >= 2 {
+			names[fields[1]] = true
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%s %s listed nothing", binary, list)
+	}
+	return names, nil
+}
@@ -0,0 +1,434 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"ffwd-ui/models"
+)
+
+// bitrateValue matches bitrates as ffmpeg takes them, such as 192k or 2.5M.
+var bitrateValue = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?[kKmM]?$`)
+
+// videoEncoder describes how to drive one ffmpeg video encoder. quality
+// turns a CRF-like value from 0 to maxQuality into encoder options.
+// presetFlag takes one of presets; an encoder without presets or tunes
+// rejects them.
+type videoEncoder struct {
+	codec      string
+	maxQuality int
+	quality    func(q int) []string
+	presetFlag string
+	presets    []string
+	tunes      []string
+}
+
+var (
+	x264Presets = []string{"ultrafast", "superfast", "veryfast", "faster", "fast", "medium", "slow", "slower", "veryslow", "placebo"}
+	qsvPresets  = []string{"veryfast", "faster", "fast", "medium", "slow", "slower", "veryslow"}
+	nvencTunes  = []string{"hq", "ll", "ull", "lossless"}
+)
+
+// videoEncoderNames lists the video_codec options of transcode in the order
+// they are offered.
+var videoEncoderNames = []string{
+	"libx264", "libx265", "libvpx-vp9", "libaom-av1", "libsvtav1",
+	"h264_nvenc", "hevc_nvenc", "av1_nvenc",
+	"h264_qsv", "hevc_qsv", "av1_qsv",
+	"h264_vaapi", "hevc_vaapi", "av1_vaapi",
+	"h264_videotoolbox", "hevc_videotoolbox",
+	"h264_amf", "hevc_amf", "av1_amf",
+}
+
+var videoEncoders = map[string]videoEncoder{
+	"libx264": {codec: "h264", maxQuality: 51, quality: crfQuality, presetFlag: "-preset", presets: x264Presets,
+		tunes: []string{"film", "animation", "grain", "stillimage", "fastdecode", "zerolatency", "psnr", "ssim"}},
+	"libx265": {codec: "hevc", maxQuality: 51, quality: crfQuality, presetFlag: "-preset", presets: x264Presets,
+		tunes: []string{"animation", "grain", "fastdecode", "zerolatency", "psnr", "ssim"}},
+	"libvpx-vp9": {codec: "vp9", maxQuality: 63, quality: constrainedCRFQuality, presetFlag: "-cpu-used", presets: numberRange(0, 8)},
+	"libaom-av1": {codec: "av1", maxQuality: 63, quality: constrainedCRFQuality, presetFlag: "-cpu-used", presets: numberRange(0, 8)},
+	"libsvtav1":  {codec: "av1", maxQuality: 63, quality: crfQuality, presetFlag: "-preset", presets: numberRange(0, 13)},
+
+	"h264_nvenc": {codec: "h264", maxQuality: 51, quality: nvencQuality, presetFlag: "-preset", presets: numberedPresets("p", 7), tunes: nvencTunes},
+	"hevc_nvenc": {codec: "hevc", maxQuality: 51, quality: nvencQuality, presetFlag: "-preset", presets: numberedPresets("p", 7), tunes: nvencTunes},
+	"av1_nvenc":  {codec: "av1", maxQuality: 63, quality: nvencQuality, presetFlag: "-preset", presets: numberedPresets("p", 7), tunes: nvencTunes},
+
+	"h264_qsv": {codec: "h264", maxQuality: 51, quality: qsvQuality, presetFlag: "-preset", presets: qsvPresets},
+	"hevc_qsv": {codec: "hevc", maxQuality: 51, quality: qsvQuality, presetFlag: "-preset", presets: qsvPresets},
+	"av1_qsv":  {codec: "av1", maxQuality: 255, quality: qsvQuality, presetFlag: "-preset", presets: qsvPresets},
+
+	"h264_vaapi": {codec: "h264", maxQuality: 51, quality: vaapiQuality},
+	"hevc_vaapi": {codec: "hevc", maxQuality: 51, quality: vaapiQuality},
+	"av1_vaapi":  {codec: "av1", maxQuality: 255, quality: vaapiQuality},
+
+	"h264_videotoolbox": {codec: "h264", maxQuality: 100, quality: videotoolboxQuality},
+	"hevc_videotoolbox": {codec: "hevc", maxQuality: 100, quality: videotoolboxQuality},
+
+	"h264_amf": {codec: "h264", maxQuality: 51, quality: amfQuality, presetFlag: "-quality", presets: []string{"speed", "balanced", "quality"}},
+	"hevc_amf": {codec: "hevc", maxQuality: 51, quality: amfQuality, presetFlag: "-quality", presets: []string{"speed", "balanced", "quality"}},
+	"av1_amf":  {codec: "av1", maxQuality: 255, quality: amfQuality, presetFlag: "-quality", presets: []string{"speed", "balanced", "quality"}},
+}
+
+// audioEncoders maps the audio_codec options of transcode to the codec
+// they produce.
+var audioEncoders = map[string]string{
+	"aac":        "aac",
+	"libopus":    "opus",
+	"libmp3lame": "mp3",
+	"flac":       "flac",
+	"alac":       "alac",
+	"ac3":        "ac3",
+	"libvorbis":  "vorbis",
+	"pcm_s16le":  "pcm_s16le",
+}
+
+// losslessAudio are the audio encoders that take no bitrate.
+var losslessAudio = []string{"flac", "alac", "pcm_s16le"}
+
+// containerFormat lists the codecs a container can hold, as ffprobe names
+// them. A nil list accepts any codec and an empty one none. audioEncoder is
+// the encoder transcode uses when the audio cannot be copied.
+type containerFormat struct {
+	video        []string
+	audio        []string
+	audioEncoder string
+}
+
+var mp4Format = containerFormat{
+	video:        []string{"h264", "hevc", "av1", "vp9", "mpeg4"},
+	audio:        []string{"aac", "mp3", "ac3", "eac3", "opus", "alac"},
+	audioEncoder: "aac",
+}
+
+var tsFormat = containerFormat{
+	video:        []string{"h264", "hevc", "mpeg2video"},
+	audio:        []string{"aac", "mp3", "mp2", "ac3", "eac3"},
+	audioEncoder: "aac",
+}
+
+// containerFormats are keyed by output file extension. Other extensions are
+// not checked.
+var containerFormats = map[string]containerFormat{
+	".mp4":  mp4Format,
+	".m4v":  mp4Format,
+	".mov":  {video: []string{"h264", "hevc", "mpeg4", "prores", "mjpeg"}, audio: []string{"aac", "mp3", "alac", "ac3", "pcm_s16le", "pcm_s24le"}, audioEncoder: "aac"},
+	".mkv":  {},
+	".webm": {video: []string{"vp8", "vp9", "av1"}, audio: []string{"opus", "vorbis"}, audioEncoder: "libopus"},
+	".avi":  {video: []string{"h264", "mpeg4", "mjpeg"}, audio: []string{"mp3", "ac3", "pcm_s16le"}, audioEncoder: "libmp3lame"},
+	".ts":   tsFormat,
+	".m2ts": tsFormat,
+	".flv":  {video: []string{"h264"}, audio: []string{"aac", "mp3"}, audioEncoder: "aac"},
+	".m4a":  {video: []string{}, audio: []string{"aac", "alac"}, audioEncoder: "aac"},
+	".mp3":  {video: []string{}, audio: []string{"mp3"}, audioEncoder: "libmp3lame"},
+	".ogg":  {video: []string{}, audio: []string{"vorbis", "opus", "flac"}, audioEncoder: "libvorbis"},
+	".opus": {video: []string{}, audio: []string{"opus"}, audioEncoder: "libopus"},
+	".flac": {video: []string{}, audio: []string{"flac"}, audioEncoder: "flac"},
+	".wav":  {video: []string{}, audio: []string{"pcm_s16le", "pcm_s24le", "pcm_f32le"}, audioEncoder: "pcm_s16le"},
+}
+
+func init() {
+	RegisterOperation(&Operation{
+		Name:  "transcode",
+		Label: "Transcode",
+		Params: []ParamSpec{
+			{Name: "video_codec", Label: "Video codec", Type: ParamString, Default: "libx264", Options: append([]string{"copy", "none"}, videoEncoderNames...)},
+			{Name: "crf", Label: "Quality (CRF, -1 for the encoder default)", Type: ParamInt, Default: -1, Min: floatPtr(-1)},
+			{Name: "preset", Label: "Preset", Type: ParamString, Default: ""},
+			{Name: "tune", Label: "Tune", Type: ParamString, Default: ""},
+			{Name: "pix_fmt", Label: "Pixel format", Type: ParamString, Default: "", Options: []string{"", "yuv420p", "yuv420p10le", "yuv422p", "yuv444p", "nv12", "p010le"}},
+			{Name: "audio_codec", Label: "Audio codec", Type: ParamString, Default: "auto", Options: []string{"auto", "copy", "none", "aac", "libopus", "libmp3lame", "flac", "alac", "ac3", "libvorbis", "pcm_s16le"}},
+			{Name: "audio_bitrate", Label: "Audio bitrate", Type: ParamString, Default: ""},
+		},
+		OutputSuffix: "_transcoded",
+		Validate:     validateTranscode,
+		Plan:         planTranscode,
+		Fallback:     fallbackTranscode,
+		Estimate:     estimateTranscode,
+		Build: func(input, output string, p Params) [][]string {
+			return [][]string{BuildTranscodeCommand(input, output, p)}
+		},
+	})
+}
+
+// BuildTranscodeCommand encodes input with the video and audio settings of
+// a transcode operation. planTranscode turns an audio codec of "auto" into
+// "copy" when the output container can hold the input's audio; left
+// unresolved, it encodes to the container's usual audio codec unless the
+// container takes any codec.
+func BuildTranscodeCommand(input, output string, p Params) []string {
+	args := []string{"-i", input}
+
+	switch name := p.String("video_codec"); name {
+	case "none":
+		args = append(args, "-vn")
+	case "copy":
+		args = append(args, "-c:v", "copy")
+	default:
+		encoder := videoEncoders[name]
+		if IsHardwareEncoder(name) {
+			inputArgs, videoArgs := HardwareVideoArgs(name, nil, "")
+			args = append(append(inputArgs, args...), videoArgs...)
+		} else {
+			args = append(args, "-c:v", name)
+		}
+		if crf := p.Int("crf"); crf >= 0 {
+			args = append(args, encoder.quality(crf)...)
+		}
+		if preset := p.String("preset"); preset != "" {
+			args = append(args, encoder.presetFlag, preset)
+		}
+		if tune := p.String("tune"); tune != "" {
+			args = append(args, "-tune", tune)
+		}
+		if pixFmt := p.String("pix_fmt"); pixFmt != "" {
+			args = append(args, "-pix_fmt", pixFmt)
+		}
+	}
+
+	audio := p.String("audio_codec")
+	if audio == "auto" {
+		audio = "copy"
+		if format, ok := containerFormats[strings.ToLower(filepath.Ext(output))]; ok && format.audio != nil {
+			audio = format.audioEncoder
+		}
+	}
+	switch audio {
+	case "none":
+		args = append(args, "-an")
+	case "copy":
+		args = append(args, "-c:a", "copy")
+	default:
+		args = append(args, "-c:a", audio)
+		if bitrate := p.String("audio_bitrate"); bitrate != "" {
+			args = append(args, "-b:a", bitrate)
+		}
+	}
+
+	return append(args, output)
+}
+
+func validateTranscode(p Params) error {
+	video := p.String("video_codec")
+	audio := p.String("audio_codec")
+	if video == "none" && audio == "none" {
+		return fmt.Errorf("keep the video, the audio or both")
+	}
+
+	if video == "copy" || video == "none" {
+		for _, name := range []string{"preset", "tune", "pix_fmt"} {
+			if p.String(name) != "" {
+				return fmt.Errorf("%s needs a video encoder, not %s", name, video)
+			}
+		}
+		if p.Int("crf") >= 0 {
+			return fmt.Errorf("crf needs a video encoder, not %s", video)
+		}
+	} else {
+		encoder := videoEncoders[video]
+		if crf := p.Int("crf"); crf > encoder.maxQuality {
+			return fmt.Errorf("crf for %s must be at most %d", video, encoder.maxQuality)
+		}
+		if preset := p.String("preset"); preset != "" && !slices.Contains(encoder.presets, preset) {
+			if len(encoder.presets) == 0 {
+				return fmt.Errorf("%s has no presets", video)
+			}
+			return fmt.Errorf("preset for %s must be one of %s", video, strings.Join(encoder.presets, ", "))
+		}
+		if tune := p.String("tune"); tune != "" && !slices.Contains(encoder.tunes, tune) {
+			if len(encoder.tunes) == 0 {
+				return fmt.Errorf("%s has no tunings", video)
+			}
+			return fmt.Errorf("tune for %s must be one of %s", video, strings.Join(encoder.tunes, ", "))
+		}
+		if p.String("pix_fmt") != "" && hardwareEncoderFor(video).API == "vaapi" {
+			return fmt.Errorf("pix_fmt cannot be set for %s, which encodes frames uploaded to the device as nv12", video)
+		}
+	}
+
+	if bitrate := p.String("audio_bitrate"); bitrate != "" {
+		if err := checkBitrates(p, "audio_bitrate").err(); err != nil {
+			return err
+		}
+		if audio == "copy" || audio == "none" || slices.Contains(losslessAudio, audio) {
+			return fmt.Errorf("audio_bitrate cannot be set with audio codec %s", audio)
+		}
+	}
+	return nil
+}
+
+// planTranscode checks the chosen codecs, or the input's codecs where they
+// are copied, against the output container, and decides whether "auto"
+// audio can be copied.
+func planTranscode(p Params, info *models.FileInfo, output string) (float64, error) {
+	ext := strings.ToLower(filepath.Ext(output))
+	format, known := containerFormats[ext]
+	if !known {
+		if p.String("audio_codec") == "auto" {
+			p["audio_codec"] = "copy"
+		}
+		return info.Duration, nil
+	}
+
+	source := mainVideoStream(info)
+	switch video := p.String("video_codec"); video {
+	case "none":
+	case "copy":
+		if source != nil && format.video != nil && len(format.video) == 0 {
+			return 0, fmt.Errorf("%s files cannot hold video; set the video codec to none", ext)
+		}
+		if source != nil && !accepts(format.video, source.Codec) {
+			return 0, fmt.Errorf("%s video cannot be copied into %s files; pick a video encoder", source.Codec, ext)
+		}
+	default:
+		if source != nil && format.video != nil && len(format.video) == 0 {
+			return 0, fmt.Errorf("%s files cannot hold video; set the video codec to none", ext)
+		}
+		if source != nil && !accepts(format.video, videoEncoders[video].codec) {
+			return 0, fmt.Errorf("%s files cannot hold %s video", ext, videoEncoders[video].codec)
+		}
+	}
+
+	sourceAudio := firstAudioStream(info)
+	switch audio := p.String("audio_codec"); audio {
+	case "none":
+	case "auto":
+		p["audio_codec"] = "copy"
+		if sourceAudio != nil && !accepts(format.audio, sourceAudio.Codec) {
+			p["audio_codec"] = format.audioEncoder
+		}
+	case "copy":
+		if sourceAudio != nil && !accepts(format.audio, sourceAudio.Codec) {
+			return 0, fmt.Errorf("%s audio cannot be copied into %s files; pick an audio codec such as %s", sourceAudio.Codec, ext, format.audioEncoder)
+		}
+	default:
+		if sourceAudio != nil && !accepts(format.audio, audioEncoders[audio]) {
+			return 0, fmt.Errorf("%s files cannot hold %s audio", ext, audioEncoders[audio])
+		}
+	}
+
+	return info.Duration, nil
+}
+
+// fallbackTranscode swaps a hardware video encoder for the software encoder
+// of the same codec, keeping the preset and tune where the software encoder
+// takes them. The quality goes back to the encoder default, since hardware
+// encoders measure it on scales of their own: VideoToolbox from 0 to 100
+// with higher being better, and some AV1 encoders up to 255.
+func fallbackTranscode(p Params) bool {
+	name := p.String("video_codec")
+	software := SoftwareEncoder(name)
+	if !IsHardwareEncoder(name) || software == "" {
+		return false
+	}
+
+	encoder := videoEncoders[software]
+	p["video_codec"] = software
+	p["crf"] = -1
+	if !slices.Contains(encoder.presets, p.String("preset")) {
+		p["preset"] = ""
+	}
+	if !slices.Contains(encoder.tunes, p.String("tune")) {
+		p["tune"] = ""
+	}
+	return true
+}
+
+// estimateTranscode sizes a transcode. A video encoder is assumed to land
+// near the input's video bitrate, since its quality settings say nothing
+// about the size; the audio uses audio_bitrate or the PCM bitrate for
+// lossless codecs.
+func estimateTranscode(p Params, info *models.FileInfo, seconds float64) float64 {
+	video, audio := streamBitrates(info)
+	if p.String("video_codec") == "none" {
+		video = 0
+	}
+
+	switch codec := p.String("audio_codec"); {
+	case codec == "none" || firstAudioStream(info) == nil:
+		audio = 0
+	case codec == "copy":
+	case codec == "flac" || codec == "alac":
+		audio = pcmBitrate(info) * flacRatio
+	case codec == "pcm_s16le":
+		audio = pcmBitrate(info)
+	default:
+		audio = parseBitrate(p.String("audio_bitrate"))
+		if audio == 0 {
+			audio = defaultAudioBitrate
+		}
+	}
+	return (video + audio) * seconds / 8
+}
+
+// checkRemux reports whether the main video and first audio stream of info
+// can be copied into output's container unchanged.
+func checkRemux(info *models.FileInfo, output string) error {
+	ext := strings.ToLower(filepath.Ext(output))
+	format, known := containerFormats[ext]
+	if !known {
+		return nil
+	}
+	if video := mainVideoStream(info); video != nil && !accepts(format.video, video.Codec) {
+		return fmt.Errorf("%s video cannot be copied into %s files; use transcode instead", video.Codec, ext)
+	}
+	if audio := firstAudioStream(info); audio != nil && !accepts(format.audio, audio.Codec) {
+		return fmt.Errorf("%s audio cannot be copied into %s files; use transcode instead", audio.Codec, ext)
+	}
+	return nil
+}
+
+func accepts(codecs []string, codec string) bool {
+	return codecs == nil || slices.Contains(codecs, codec)
+}
+
+func crfQuality(q int) []string {
+	return []string{"-crf", strconv.Itoa(q)}
+}
+
+// constrainedCRFQuality is constant quality for libvpx and libaom, which
+// otherwise cap the bitrate at their default target.
+func constrainedCRFQuality(q int) []string {
+	return []string{"-crf", strconv.Itoa(q), "-b:v", "0"}
+}
+
+func nvencQuality(q int) []string {
+	return []string{"-rc", "vbr", "-cq", strconv.Itoa(q), "-b:v", "0"}
+}
+
+func qsvQuality(q int) []string {
+	return []string{"-global_quality", strconv.Itoa(q)}
+}
+
+func vaapiQuality(q int) []string {
+	return []string{"-rc_mode", "CQP", "-qp", strconv.Itoa(q)}
+}
+
+// videotoolboxQuality takes 0 to 100 like the encoder's -q:v, where higher
+// is better.
+func videotoolboxQuality(q int) []string {
+	return []string{"-q:v", strconv.Itoa(q)}
+}
+
+func amfQuality(q int) []string {
+	return []string{"-rc", "cqp", "-qp_i", strconv.Itoa(q), "-qp_p", strconv.Itoa(q)}
+}
+
+func numberRange(from, to int) []string {
+	var values []string
+	for n := from; n <= to; n++ {
+		values = append(values, strconv.Itoa(n))
+	}
+	return values
+}
+
+func numberedPresets(prefix string, n int) []string {
+	values := numberRange(1, n)
+	for i := range values {
+		values[i] = prefix + values[i]
+	}
+	return values
+}
@@ -0,0 +1,56 @@
+package ffmpeg
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestFallbackTranscode(t *testing.T) {
+	tests := []struct {
+		name  string
+		p     Params
+		ok    bool
+		wantP Params
+	}{
+		{
+			name:  "software encoder",
+			p:     Params{"video_codec": "libx264", "crf": 23, "preset": "slow", "tune": "film"},
+			ok:    false,
+			wantP: Params{"video_codec": "libx264", "crf": 23, "preset": "slow", "tune": "film"},
+		},
+		{
+			name:  "nvenc keeps nothing of its own",
+			p:     Params{"video_codec": "h264_nvenc", "crf": 23, "preset": "p4", "tune": "hq"},
+			ok:    true,
+			wantP: Params{"video_codec": "libx264", "crf": -1, "preset": "", "tune": ""},
+		},
+		{
+			name:  "qsv keeps a shared preset",
+			p:     Params{"video_codec": "hevc_qsv", "crf": 30, "preset": "slow", "tune": ""},
+			ok:    true,
+			wantP: Params{"video_codec": "libx265", "crf": -1, "preset": "slow", "tune": ""},
+		},
+		{
+			name:  "videotoolbox quality is not a crf",
+			p:     Params{"video_codec": "h264_videotoolbox", "crf": 80, "preset": "", "tune": ""},
+			ok:    true,
+			wantP: Params{"video_codec": "libx264", "crf": -1, "preset": "", "tune": ""},
+		},
+		{
+			name:  "av1 quality up to 255",
+			p:     Params{"video_codec": "av1_vaapi", "crf": 200, "preset": "", "tune": ""},
+			ok:    true,
+			wantP: Params{"video_codec": "libsvtav1", "crf": -1, "preset": "", "tune": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ok := fallbackTranscode(tt.p); ok != tt.ok {
+				t.Errorf("fallbackTranscode returned %v, want %v", ok, tt.ok)
+			}
+			if !maps.Equal(tt.p, tt.wantP) {
+				t.Errorf("params are %v, want %v", tt.p, tt.wantP)
+			}
+		})
+	}
+}
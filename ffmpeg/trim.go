@@ -0,0 +1,368 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"ffwd-ui/models"
+)
+
+// segmentsListFile is the name of the concat list joining the parts of a
+// smart cut in WorkDir.
+const segmentsListFile = "segments.txt"
+
+// trimModeParam selects how the trim operations cut:
+//
+//   - copy stream-copies, so video starts at the keyframe at or before the
+//     requested start. Plan records that keyframe as "cut_start".
+//   - precise re-encodes the video and cuts exactly.
+//   - smart re-encodes only the video before the first keyframe and after
+//     the last one in the kept range, and stream-copies the GOPs between
+//     them. Plan records the cut as "smart_cut"; without it, as inside a
+//     pipeline, when the range holds no whole GOP, or when the ends cannot
+//     be encoded to match the source, the cut is precise.
+var trimModeParam = ParamSpec{Name: "mode", Label: "Cut", Type: ParamString, Default: "copy", Options: []string{"copy", "precise", "smart"}}
+
+// smartCutCodec says how to re-encode the ends of a smart cut so that
+// they decode like the stream-copied middle: the encoder, at a quality
+// close enough not to be noticed, the encoder's names for the profiles
+// ffprobe reports, and the arguments selecting a level.
+type smartCutCodec struct {
+	encoder  []string
+	profiles map[string]string
+	level    func(level int) []string
+}
+
+// smartCutCodecs are the codecs a smart cut can match. The cut falls back
+// to precise for other codecs and for profiles that are not listed.
+var smartCutCodecs = map[string]smartCutCodec{
+	"h264": {
+		encoder: []string{"-c:v", "libx264", "-crf", "18"},
+		profiles: map[string]string{
+			"Constrained Baseline":  "baseline",
+			"Baseline":              "baseline",
+			"Main":                  "main",
+			"High":                  "high",
+			"High 10":               "high10",
+			"High 4:2:2":            "high422",
+			"High 4:4:4 Predictive": "high444",
+		},
+		level: func(level int) []string {
+			return []string{"-level:v", fmt.Sprintf("%d.%d", level/10, level%10)}
+		},
+	},
+	"hevc": {
+		encoder: []string{"-c:v", "libx265", "-crf", "20"},
+		profiles: map[string]string{
+			"Main":    "main",
+			"Main 10": "main10",
+		},
+		// ffprobe reports HEVC levels times 30.
+		level: func(level int) []string {
+			return []string{"-x265-params", "level-idc=" + strconv.FormatFloat(float64(level)/30, 'f', 1, 64)}
+		},
+	},
+}
+
+// timescaleMuxers take the time base of the output's video track from
+// -video_track_timescale rather than from the input.
+var timescaleMuxers = map[string]bool{"mp4": true, "mov": true, "ipod": true, "3gp": true, "f4v": true}
+
+// SmartCut is the plan of a smart-cut trim. The video from Start to the
+// first keyframe at or after it, KeyframeStart, and from the last keyframe
+// before End, KeyframeEnd, to End is re-encoded with the Encoder arguments;
+// everything between the two keyframes is stream-copied. An End of zero
+// keeps the rest of the input, which then needs no re-encoded tail, and
+// KeyframeEnd is zero too. TimeScale is the time base denominator of the
+// source's video, for outputs that would otherwise pick their own.
+type SmartCut struct {
+	Start         float64  `json:"start"`
+	KeyframeStart float64  `json:"keyframe_start"`
+	KeyframeEnd   float64  `json:"keyframe_end"`
+	End           float64  `json:"end"`
+	Encoder       []string `json:"encoder"`
+	TimeScale     int      `json:"time_scale,omitempty"`
+}
+
+// cutSegment is one part of a smart cut. A to of zero runs to the end of
+// the input.
+type cutSegment struct {
+	name     string
+	from, to float64
+	copy     bool
+}
+
+func (c *SmartCut) segments() []cutSegment {
+	var segments []cutSegment
+	if c.KeyframeStart > c.Start {
+		segments = append(segments, cutSegment{name: "head.ts", from: c.Start, to: c.KeyframeStart})
+	}
+
+	middleEnd := c.End
+	if c.KeyframeEnd > 0 {
+		middleEnd = c.KeyframeEnd
+	}
+	segments = append(segments, cutSegment{name: "middle.ts", from: c.KeyframeStart, to: middleEnd, copy: true})
+
+	if c.KeyframeEnd > 0 && c.End > c.KeyframeEnd {
+		segments = append(segments, cutSegment{name: "tail.ts", from: c.KeyframeEnd, to: c.End})
+	}
+	return segments
+}
+
+// BuildPreciseTrimCommand keeps input from start to end seconds, or to the
+// end of the input when end is zero, re-encoding the video so that the cut
+// lands on the exact frame. Audio is copied.
+func BuildPreciseTrimCommand(input, output string, start, end float64) []string {
+	var args []string
+	if start > 0 {
+		args = append(args, "-ss", formatSeconds(start))
+	}
+	if end > 0 {
+		args = append(args, "-to", formatSeconds(end))
+	}
+	return append(args, "-i", input, "-c:a", "copy", output)
+}
+
+// BuildSmartCutCommands returns the passes of a smart cut: one per segment
+// of the video, each written to WorkDir, and a last one joining them with
+// the concat demuxer using the list from BuildSegmentsList. The segments
+// are MPEG-TS, which repeats the parameter sets of each part before its
+// keyframes, so that the decoder switches between those of the re-encoded
+// ends and the copied middle where they meet. The last pass copies the
+// audio and subtitle streams of the whole range from the input. Only the
+// main video stream is kept.
+func BuildSmartCutCommands(input, output string, cut *SmartCut) [][]string {
+	segments := cut.segments()
+	if len(segments) == 1 {
+		args := trimRange([]string{"-i", input}, segments[0].from, segments[0].to)
+		return [][]string{append(args, "-map", "0:V:0", "-map", "0:a?", "-map", "0:s?", "-c", "copy", output)}
+	}
+
+	var passes [][]string
+	for _, segment := range segments {
+		passes = append(passes, segmentCommand(input, WorkDir+"/"+segment.name, segment, cut.Encoder))
+	}
+
+	join := []string{
+		"-f", "concat",
+		"-safe", "0",
+		"-i", WorkDir + "/" + segmentsListFile,
+	}
+	join = append(join, trimRange([]string{"-i", input}, cut.Start, cut.End)...)
+	join = append(join, "-map", "0:v", "-map", "1:a?", "-map", "1:s?", "-c", "copy")
+	if cut.TimeScale > 0 && timescaleMuxers[outputMuxers[strings.ToLower(filepath.Ext(output))]] {
+		join = append(join, "-video_track_timescale", strconv.Itoa(cut.TimeScale))
+	}
+	return append(passes, append(join, output))
+}
+
+// trimRange returns input, the arguments opening an input, preceded by
+// those seeking it to from and stopping it at to, where a to of zero runs
+// to the end.
+func trimRange(input []string, from, to float64) []string {
+	args := []string{"-ss", formatSeconds(from)}
+	if to > 0 {
+		args = append(args, "-to", formatSeconds(to))
+	}
+	return append(args, input...)
+}
+
+func segmentCommand(input, output string, segment cutSegment, encoder []string) []string {
+	args := append(trimRange([]string{"-i", input}, segment.from, segment.to), "-map", "0:V:0")
+	if segment.copy {
+		args = append(args, "-c", "copy")
+	} else {
+		args = append(args, encoder...)
+	}
+	return append(args, output)
+}
+
+// BuildSegmentsList renders the concat list joining the parts of cut.
+// Names are relative to the list, which is in WorkDir with the parts.
+func BuildSegmentsList(cut *SmartCut) string {
+	var list string
+	for _, segment := range cut.segments() {
+		list += fmt.Sprintf("file '%s'\n", segment.name)
+	}
+	return list
+}
+
+// buildTrim returns the passes of a precise or smart trim keeping start to
+// end seconds of input, or nil for a copy trim, which each operation builds
+// itself.
+func buildTrim(input, output string, p Params, start, end float64) [][]string {
+	switch p.String("mode") {
+	case "smart":
+		if cut, ok := p["smart_cut"].(*SmartCut); ok {
+			return BuildSmartCutCommands(input, output, cut)
+		}
+		fallthrough
+	case "precise":
+		return [][]string{BuildPreciseTrimCommand(input, output, start, end)}
+	}
+	return nil
+}
+
+// trimFiles returns the concat list of a planned smart cut.
+func trimFiles(input string, p Params) map[string]string {
+	cut, ok := p["smart_cut"].(*SmartCut)
+	if !ok || p.String("mode") != "smart" || len(cut.segments()) == 1 {
+		return nil
+	}
+	return map[string]string{segmentsListFile: BuildSegmentsList(cut)}
+}
+
+// trimCutStart returns where a copy trim requested to start at start
+// actually cuts.
+func trimCutStart(p Params, start float64) float64 {
+	if cut, ok := p["cut_start"].(float64); ok {
+		return cut
+	}
+	return start
+}
+
+// trimDurations returns the output length of each pass of a trim keeping
+// start to end seconds, where an end of zero means the end of the input.
+func trimDurations(p Params, start, end, inputDuration float64) []float64 {
+	if end <= 0 || (inputDuration > 0 && end > inputDuration) {
+		end = inputDuration
+	}
+
+	switch p.String("mode") {
+	case "copy":
+		start = trimCutStart(p, start)
+	case "smart":
+		cut, ok := p["smart_cut"].(*SmartCut)
+		if !ok {
+			break
+		}
+		var durations []float64
+		for _, segment := range cut.segments() {
+			to := segment.to
+			if to <= 0 {
+				to = end
+			}
+			durations = append(durations, clampDuration(to-segment.from))
+		}
+		if len(durations) == 1 {
+			return durations
+		}
+		return append(durations, clampDuration(end-start))
+	}
+	return []float64{clampDuration(end - start)}
+}
+
+// planTrim looks up the keyframes around the cut points of a copy or smart
+// trim keeping start to end seconds of info, and records where the cut
+// will happen. Files without video are cut exactly by stream copy.
+func planTrim(p Params, info *models.FileInfo, start, end float64) (float64, error) {
+	if info.Duration > 0 && end >= info.Duration {
+		end = 0
+	}
+
+	mode := p.String("mode")
+	if mode == "precise" || (mode == "copy" && start == 0) {
+		return info.Duration, nil
+	}
+	if mainVideoStream(info) == nil {
+		p["mode"] = "copy"
+		return info.Duration, nil
+	}
+
+	if mode == "copy" {
+		keyframes, err := ProbeKeyframes(info, start, start)
+		if err != nil {
+			return 0, err
+		}
+		if len(keyframes) > 0 && keyframes[0] <= start {
+			p["cut_start"] = keyframes[0]
+		}
+		return info.Duration, nil
+	}
+
+	keyframes, err := ProbeKeyframes(info, start, end)
+	if err != nil {
+		return 0, err
+	}
+	cut := planSmartCut(info, keyframes, start, end)
+	if cut == nil {
+		p["mode"] = "precise"
+	} else {
+		p["smart_cut"] = cut
+	}
+	return info.Duration, nil
+}
+
+// planSmartCut places a smart cut keeping start to end seconds of info on
+// its keyframes. It returns nil when the range holds no whole GOP, so that
+// there is nothing to copy, or when the ends cannot be re-encoded with the
+// codec and profile of the source.
+func planSmartCut(info *models.FileInfo, keyframes []float64, start, end float64) *SmartCut {
+	encoder := smartCutEncoder(mainVideoStream(info))
+	if encoder == nil {
+		return nil
+	}
+
+	cut := &SmartCut{Start: start, KeyframeStart: -1, End: end, Encoder: encoder}
+	if _, denominator, ok := strings.Cut(mainVideoStream(info).TimeBase, "/"); ok {
+		cut.TimeScale, _ = strconv.Atoi(denominator)
+	}
+
+	for _, keyframe := range keyframes {
+		if keyframe >= start {
+			cut.KeyframeStart = keyframe
+			break
+		}
+	}
+	if cut.KeyframeStart < 0 || (end > 0 && cut.KeyframeStart >= end) {
+		return nil
+	}
+
+	if end > 0 {
+		for _, keyframe := range keyframes {
+			if keyframe <= end {
+				cut.KeyframeEnd = keyframe
+			}
+		}
+		if cut.KeyframeEnd <= cut.KeyframeStart {
+			return nil
+		}
+	}
+	return cut
+}
+
+// smartCutEncoder returns the arguments re-encoding the ends of a smart cut
+// of stream with its codec, profile, level, pixel format and time base, or
+// nil when they cannot be matched.
+func smartCutEncoder(stream *models.StreamInfo) []string {
+	codec, ok := smartCutCodecs[stream.Codec]
+	if !ok {
+		return nil
+	}
+	profile, ok := codec.profiles[stream.Profile]
+	if !ok {
+		return nil
+	}
+
+	encoder := append([]string{}, codec.encoder...)
+	encoder = append(encoder, "-profile:v", profile)
+	if stream.Level > 0 {
+		encoder = append(encoder, codec.level(stream.Level)...)
+	}
+	if stream.PixelFormat != "" {
+		encoder = append(encoder, "-pix_fmt", stream.PixelFormat)
+	}
+	if stream.TimeBase != "" {
+		encoder = append(encoder, "-enc_time_base:v", stream.TimeBase)
+	}
+	return encoder
+}
+
+// formatSeconds formats a time for ffmpeg without rounding, so that a
+// keyframe time read from ffprobe seeks to that keyframe.
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', -1, 64)
+}
@@ -0,0 +1,181 @@
+package ffmpeg
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"ffwd-ui/models"
+)
+
+// maxVolumePercent is the loudest adjust_volume allows, +20 dB.
+const maxVolumePercent = 1000
+
+// ValidationError lists the parameters of an operation that are not
+// acceptable, each with a message for showing next to its input. Problems
+// that concern no single parameter have an empty Field.
+type ValidationError struct {
+	Fields []models.FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Message
+		if field.Field != "" {
+			messages[i] = field.Field + ": " + field.Message
+		}
+	}
+	return strings.Join(messages, "; ")
+}
+
+// fieldErrors collects the problems found by a validator. Its err returns
+// them as a *ValidationError, or nil when there are none.
+type fieldErrors []models.FieldError
+
+func (e *fieldErrors) add(field, format string, args ...interface{}) {
+	*e = append(*e, models.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (e fieldErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: e}
+}
+
+// FieldErrors returns the field-level problems in err, or err as a single
+// problem with no field when it is not a *ValidationError.
+func FieldErrors(err error) []models.FieldError {
+	var validation *ValidationError
+	if errors.As(err, &validation) {
+		return validation.Fields
+	}
+	return []models.FieldError{{Message: err.Error()}}
+}
+
+// fieldError returns err as the problem of field.
+func fieldError(field string, err error) error {
+	return &ValidationError{Fields: []models.FieldError{{Field: field, Message: err.Error()}}}
+}
+
+// frameSize returns the size of the frames of stream as the filters see
+// them, which is after ffmpeg has applied the rotation.
+func frameSize(stream *models.StreamInfo) (width, height int) {
+	if stream.Rotation%180 != 0 {
+		return stream.Height, stream.Width
+	}
+	return stream.Width, stream.Height
+}
+
+// chromaAlignment returns what the width and height of frames in pixFmt
+// must be multiples of. Formats with subsampled chroma, such as yuv420p,
+// need even dimensions; the encoders keep the input's format unless told
+// otherwise, and one that is not known is taken to be 4:2:0.
+func chromaAlignment(pixFmt string) (width, height int) {
+	switch {
+	case strings.Contains(pixFmt, "444"), strings.HasPrefix(pixFmt, "rgb"), strings.HasPrefix(pixFmt, "bgr"), strings.HasPrefix(pixFmt, "gray"):
+		return 1, 1
+	case strings.Contains(pixFmt, "422"), strings.Contains(pixFmt, "411"):
+		return 2, 1
+	}
+	return 2, 2
+}
+
+// checkEven adds an error for a width or height that frames in pixFmt
+// cannot have.
+func checkEven(errs *fieldErrors, pixFmt string, width, height int) {
+	alignWidth, alignHeight := chromaAlignment(pixFmt)
+	if pixFmt == "" {
+		pixFmt = "yuv420p"
+	}
+	if width%alignWidth != 0 {
+		errs.add("width", "must be even for %s video", pixFmt)
+	}
+	if height%alignHeight != 0 {
+		errs.add("height", "must be even for %s video", pixFmt)
+	}
+}
+
+// checkTrimStart adds an error for a cut that starts at or after the end
+// of the input.
+func checkTrimStart(errs *fieldErrors, field string, start float64, info *models.FileInfo) {
+	if info.Duration > 0 && start >= info.Duration {
+		errs.add(field, "must be before the end of the input at %.2f seconds", info.Duration)
+	}
+}
+
+// checkTrimEnd adds an error for a cut that ends, end seconds into the
+// input, after the input does.
+func checkTrimEnd(errs *fieldErrors, field string, end float64, info *models.FileInfo) {
+	if info.Duration > 0 && end > info.Duration {
+		errs.add(field, "must be at most the length of the input, %.2f seconds", info.Duration)
+	}
+}
+
+// checkCrop keeps the crop rectangle inside the frame and its size even
+// where the pixel format needs it.
+func checkCrop(p Params, info *models.FileInfo) error {
+	stream := mainVideoStream(info)
+	if stream == nil {
+		return fmt.Errorf("the input has no video to crop")
+	}
+
+	var errs fieldErrors
+	frameWidth, frameHeight := frameSize(stream)
+	width, height, x, y := p.Int("width"), p.Int("height"), p.Int("x"), p.Int("y")
+	if frameWidth > 0 {
+		if width > frameWidth {
+			errs.add("width", "must be at most the frame width of %d", frameWidth)
+		} else if x+width > frameWidth {
+			errs.add("x", "must be at most %d for a width of %d", frameWidth-width, width)
+		}
+	}
+	if frameHeight > 0 {
+		if height > frameHeight {
+			errs.add("height", "must be at most the frame height of %d", frameHeight)
+		} else if y+height > frameHeight {
+			errs.add("y", "must be at most %d for a height of %d", frameHeight-height, height)
+		}
+	}
+	checkEven(&errs, stream.PixelFormat, width, height)
+	return errs.err()
+}
+
+// checkResolution checks the target size of change_resolution against the
+// pixel format it is encoded in. A zero dimension is left to the scale
+// filter, which keeps the aspect ratio and rounds it to even.
+func checkResolution(p Params, info *models.FileInfo) error {
+	stream := mainVideoStream(info)
+	if stream == nil {
+		return fmt.Errorf("the input has no video to resize")
+	}
+
+	pixFmt := stream.PixelFormat
+	if hw := p.String("hw_accel"); hw != "" && hw != "none" {
+		// Every hardware pipeline encodes 4:2:0 frames.
+		pixFmt = "nv12"
+	}
+
+	var errs fieldErrors
+	checkEven(&errs, pixFmt, p.Int("width"), p.Int("height"))
+	return errs.err()
+}
+
+// checkBitrates validates the bitrate parameters named by fields, which
+// may be empty.
+func checkBitrates(p Params, fields ...string) fieldErrors {
+	var errs fieldErrors
+	for _, field := range fields {
+		value := p.String(field)
+		if value == "" {
+			continue
+		}
+		if !bitrateValue.MatchString(value) {
+			errs.add(field, "must be a number of bit/s with an optional k or M, such as 500k or 2M, got %q", value)
+		} else if parseBitrate(value) <= 0 {
+			errs.add(field, "must be greater than zero")
+		}
+	}
+	return errs
+}
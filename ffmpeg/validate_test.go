@@ -0,0 +1,86 @@
+package ffmpeg
+
+import (
+	"testing"
+
+	"ffwd-ui/models"
+)
+
+func TestCheckTrimStart(t *testing.T) {
+	tests := []struct {
+		name     string
+		start    float64
+		duration float64
+		wantErr  bool
+	}{
+		{"inside", 5, 10, false},
+		{"at zero", 0, 10, false},
+		{"at the end", 10, 10, true},
+		{"past the end", 12, 10, true},
+		{"unknown duration", 12, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs fieldErrors
+			checkTrimStart(&errs, "seconds", tt.start, &models.FileInfo{Duration: tt.duration})
+			if got := len(errs) > 0; got != tt.wantErr {
+				t.Fatalf("checkTrimStart(%v) on %v seconds: errors %v, want error %v", tt.start, tt.duration, errs, tt.wantErr)
+			}
+			if tt.wantErr && errs[0].Field != "seconds" {
+				t.Errorf("error is for field %q, want seconds", errs[0].Field)
+			}
+		})
+	}
+}
+
+func TestCheckTrimEnd(t *testing.T) {
+	tests := []struct {
+		name     string
+		end      float64
+		duration float64
+		wantErr  bool
+	}{
+		{"inside", 5, 10, false},
+		{"at the end", 10, 10, false},
+		{"past the end", 10.5, 10, true},
+		{"unknown duration", 30, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs fieldErrors
+			checkTrimEnd(&errs, "end_seconds", tt.end, &models.FileInfo{Duration: tt.duration})
+			if got := len(errs) > 0; got != tt.wantErr {
+				t.Fatalf("checkTrimEnd(%v) on %v seconds: errors %v, want error %v", tt.end, tt.duration, errs, tt.wantErr)
+			}
+			if tt.wantErr && errs[0].Field != "end_seconds" {
+				t.Errorf("error is for field %q, want end_seconds", errs[0].Field)
+			}
+		})
+	}
+}
+
+func TestChangeResolutionValidate(t *testing.T) {
+	op, err := LookupOperation("change_resolution")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		width, height int
+		wantErr       bool
+	}{
+		{"both set", 1280, 720, false},
+		{"width only", 640, 0, false},
+		{"height only", 0, 480, false},
+		{"neither", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := op.Resolve(map[string]interface{}{"width": tt.width, "height": tt.height})
+			if got := err != nil; got != tt.wantErr {
+				t.Errorf("%dx%d: error %v, want error %v", tt.width, tt.height, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,41 +1,120 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 import {models} from '../models';
+import {ffmpeg} from '../models';
 
-export function AddPadding(arg1:string,arg2:string,arg3:number,arg4:number):Promise<void>;
+export function AddPadding(arg1:string,arg2:string,arg3:number,arg4:number):Promise<string>;
 
-export function AdjustBitrate(arg1:string,arg2:string,arg3:string,arg4:string,arg5:string,arg6:boolean):Promise<void>;
+export function AdjustBitrate(arg1:string,arg2:string,arg3:string,arg4:string,arg5:string,arg6:boolean):Promise<string>;
 
-export function AdjustVolume(arg1:string,arg2:string,arg3:number):Promise<void>;
+export function AdjustVolume(arg1:string,arg2:string,arg3:number):Promise<string>;
+
+export function ApplyPreset(arg1:string):Promise<models.OperationParams>;
+
+export function CancelJob(arg1:string):Promise<void>;
 
 export function CancelOperation():Promise<void>;
 
-export function ChangeResolution(arg1:string,arg2:string,arg3:number,arg4:number,arg5:string):Promise<void>;
+export function ChangeResolution(arg1:string,arg2:string,arg3:number,arg4:number,arg5:string):Promise<string>;
+
+export function CheckDiskSpace(arg1:string,arg2:string,arg3:string,arg4:Record<string, any>):Promise<models.SpaceCheck>;
+
+export function CheckOutput(arg1:string):Promise<models.OutputCheck>;
+
+export function ClearFinishedJobs():Promise<void>;
 
-export function ConvertFormat(arg1:string,arg2:string):Promise<void>;
+export function ClearHistory():Promise<void>;
 
-export function CropVideo(arg1:string,arg2:string,arg3:number,arg4:number,arg5:number,arg6:number):Promise<void>;
+export function ConvertFormat(arg1:string,arg2:string):Promise<string>;
+
+export function CropVideo(arg1:string,arg2:string,arg3:number,arg4:number,arg5:number,arg6:number):Promise<string>;
+
+export function DeletePreset(arg1:string):Promise<void>;
 
 export function DetectHardwareEncoder():Promise<string>;
 
-export function ExtractAudio(arg1:string,arg2:string,arg3:string):Promise<void>;
+export function EditMetadata(arg1:string,arg2:string,arg3:string,arg4:string,arg5:string,arg6:string,arg7:Array<models.Chapter>,arg8:boolean):Promise<string>;
+
+export function ExportHistoryScript(arg1:Array<string>,arg2:string):Promise<void>;
+
+export function ExportPresets(arg1:string,arg2:Array<string>):Promise<void>;
+
+export function ExtractAudio(arg1:string,arg2:string,arg3:string):Promise<string>;
 
 export function ExtractThumbnail(arg1:string):Promise<string>;
 
+export function FitToSize(arg1:string,arg2:string,arg3:number,arg4:string):Promise<string>;
+
+export function GetBatch(arg1:string):Promise<models.BatchSummary>;
+
 export function GetDefaultOutputName(arg1:string,arg2:string):Promise<string>;
 
 export function GetDiskSpace():Promise<Array<models.MountPoint>>;
 
 export function GetFileInfo(arg1:string):Promise<models.FileInfo>;
 
+export function GetHardwareEncoders(arg1:boolean):Promise<Array<models.HardwareEncoder>>;
+
+export function GetHistory(arg1:models.HistoryQuery):Promise<Array<models.HistoryEntry>>;
+
+export function GetHistoryScript(arg1:Array<string>):Promise<string>;
+
+export function GetJob(arg1:string):Promise<models.Job>;
+
+export function GetKeyframes(arg1:string):Promise<Array<number>>;
+
+export function GetMaxConcurrentJobs():Promise<number>;
+
+export function GetOperations():Promise<Array<ffmpeg.Operation>>;
+
+export function GetSettings():Promise<models.Settings>;
+
+export function GetToolchain():Promise<models.Toolchain>;
+
+export function ImportPresets(arg1:string):Promise<number>;
+
+export function JoinFiles(arg1:Array<string>,arg2:string,arg3:string):Promise<string>;
+
+export function ListJobs():Promise<Array<models.Job>>;
+
+export function ListPresets():Promise<Array<models.Preset>>;
+
 export function PreviewCommand(arg1:string,arg2:string,arg3:string,arg4:Record<string, any>):Promise<string>;
 
+export function PreviewPipeline(arg1:string,arg2:string,arg3:Array<models.PipelineStep>):Promise<string>;
+
+export function RenamePreset(arg1:string,arg2:string):Promise<void>;
+
+export function RerunHistoryEntry(arg1:string,arg2:string):Promise<string>;
+
+export function RunBatch(arg1:models.BatchRequest):Promise<models.BatchSummary>;
+
+export function RunOperation(arg1:string,arg2:string,arg3:string,arg4:Record<string, any>):Promise<string>;
+
+export function RunOperationWithOverwrite(arg1:string,arg2:string,arg3:string,arg4:Record<string, any>,arg5:string):Promise<string>;
+
+export function RunPipeline(arg1:string,arg2:string,arg3:Array<models.PipelineStep>):Promise<string>;
+
+export function RunPreset(arg1:string,arg2:string,arg3:string):Promise<string>;
+
+export function SavePreset(arg1:string,arg2:models.OperationParams):Promise<models.Preset>;
+
+export function SaveSettings(arg1:models.Settings):Promise<models.Toolchain>;
+
 export function SelectInputFile():Promise<string>;
 
 export function SelectOutputFile(arg1:string):Promise<string>;
 
-export function TrimRange(arg1:string,arg2:string,arg3:number,arg4:number):Promise<void>;
+export function SelectStreams(arg1:string,arg2:string,arg3:Array<models.StreamSelection>):Promise<string>;
+
+export function SetMaxConcurrentJobs(arg1:number):Promise<void>;
+
+export function Transcode(arg1:string,arg2:string,arg3:models.TranscodeSettings):Promise<string>;
+
+export function TrimRange(arg1:string,arg2:string,arg3:number,arg4:number,arg5:string):Promise<string>;
+
+export function TrimStart(arg1:string,arg2:string,arg3:number,arg4:string):Promise<string>;
 
-export function TrimStart(arg1:string,arg2:string,arg3:number):Promise<void>;
+export function TrimToLength(arg1:string,arg2:string,arg3:number,arg4:string):Promise<string>;
 
-export function TrimToLength(arg1:string,arg2:string,arg3:number):Promise<void>;
+export function ValidateOperation(arg1:string,arg2:string,arg3:Record<string, any>):Promise<Array<models.FieldError>>;
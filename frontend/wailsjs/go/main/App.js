@@ -14,6 +14,14 @@ export function AdjustVolume(arg1, arg2, arg3) {
   return window['go']['main']['App']['AdjustVolume'](arg1, arg2, arg3);
 }
 
+export function ApplyPreset(arg1) {
+  return window['go']['main']['App']['ApplyPreset'](arg1);
+}
+
+export function CancelJob(arg1) {
+  return window['go']['main']['App']['CancelJob'](arg1);
+}
+
 export function CancelOperation() {
   return window['go']['main']['App']['CancelOperation']();
 }
@@ -22,6 +30,22 @@ export function ChangeResolution(arg1, arg2, arg3, arg4, arg5) {
   return window['go']['main']['App']['ChangeResolution'](arg1, arg2, arg3, arg4, arg5);
 }
 
+export function CheckDiskSpace(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['CheckDiskSpace'](arg1, arg2, arg3, arg4);
+}
+
+export function CheckOutput(arg1) {
+  return window['go']['main']['App']['CheckOutput'](arg1);
+}
+
+export function ClearFinishedJobs() {
+  return window['go']['main']['App']['ClearFinishedJobs']();
+}
+
+export function ClearHistory() {
+  return window['go']['main']['App']['ClearHistory']();
+}
+
 export function ConvertFormat(arg1, arg2) {
   return window['go']['main']['App']['ConvertFormat'](arg1, arg2);
 }
@@ -30,10 +54,26 @@ export function CropVideo(arg1, arg2, arg3, arg4, arg5, arg6) {
   return window['go']['main']['App']['CropVideo'](arg1, arg2, arg3, arg4, arg5, arg6);
 }
 
+export function DeletePreset(arg1) {
+  return window['go']['main']['App']['DeletePreset'](arg1);
+}
+
 export function DetectHardwareEncoder() {
   return window['go']['main']['App']['DetectHardwareEncoder']();
 }
 
+export function EditMetadata(arg1, arg2, arg3, arg4, arg5, arg6, arg7, arg8) {
+  return window['go']['main']['App']['EditMetadata'](arg1, arg2, arg3, arg4, arg5, arg6, arg7, arg8);
+}
+
+export function ExportHistoryScript(arg1, arg2) {
+  return window['go']['main']['App']['ExportHistoryScript'](arg1, arg2);
+}
+
+export function ExportPresets(arg1, arg2) {
+  return window['go']['main']['App']['ExportPresets'](arg1, arg2);
+}
+
 export function ExtractAudio(arg1, arg2, arg3) {
   return window['go']['main']['App']['ExtractAudio'](arg1, arg2, arg3);
 }
@@ -42,6 +82,14 @@ export function ExtractThumbnail(arg1) {
   return window['go']['main']['App']['ExtractThumbnail'](arg1);
 }
 
+export function FitToSize(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['FitToSize'](arg1, arg2, arg3, arg4);
+}
+
+export function GetBatch(arg1) {
+  return window['go']['main']['App']['GetBatch'](arg1);
+}
+
 export function GetDefaultOutputName(arg1, arg2) {
   return window['go']['main']['App']['GetDefaultOutputName'](arg1, arg2);
 }
@@ -54,10 +102,102 @@ export function GetFileInfo(arg1) {
   return window['go']['main']['App']['GetFileInfo'](arg1);
 }
 
+export function GetHardwareEncoders(arg1) {
+  return window['go']['main']['App']['GetHardwareEncoders'](arg1);
+}
+
+export function GetHistory(arg1) {
+  return window['go']['main']['App']['GetHistory'](arg1);
+}
+
+export function GetHistoryScript(arg1) {
+  return window['go']['main']['App']['GetHistoryScript'](arg1);
+}
+
+export function GetJob(arg1) {
+  return window['go']['main']['App']['GetJob'](arg1);
+}
+
+export function GetKeyframes(arg1) {
+  return window['go']['main']['App']['GetKeyframes'](arg1);
+}
+
+export function GetMaxConcurrentJobs() {
+  return window['go']['main']['App']['GetMaxConcurrentJobs']();
+}
+
+export function GetOperations() {
+  return window['go']['main']['App']['GetOperations']();
+}
+
+export function GetSettings() {
+  return window['go']['main']['App']['GetSettings']();
+}
+
+export function GetToolchain() {
+  return window['go']['main']['App']['GetToolchain']();
+}
+
+export function ImportPresets(arg1) {
+  return window['go']['main']['App']['ImportPresets'](arg1);
+}
+
+export function JoinFiles(arg1, arg2, arg3) {
+  return window['go']['main']['App']['JoinFiles'](arg1, arg2, arg3);
+}
+
+export function ListJobs() {
+  return window['go']['main']['App']['ListJobs']();
+}
+
+export function ListPresets() {
+  return window['go']['main']['App']['ListPresets']();
+}
+
 export function PreviewCommand(arg1, arg2, arg3, arg4) {
   return window['go']['main']['App']['PreviewCommand'](arg1, arg2, arg3, arg4);
 }
 
+export function PreviewPipeline(arg1, arg2, arg3) {
+  return window['go']['main']['App']['PreviewPipeline'](arg1, arg2, arg3);
+}
+
+export function RenamePreset(arg1, arg2) {
+  return window['go']['main']['App']['RenamePreset'](arg1, arg2);
+}
+
+export function RerunHistoryEntry(arg1, arg2) {
+  return window['go']['main']['App']['RerunHistoryEntry'](arg1, arg2);
+}
+
+export function RunBatch(arg1) {
+  return window['go']['main']['App']['RunBatch'](arg1);
+}
+
+export function RunOperation(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['RunOperation'](arg1, arg2, arg3, arg4);
+}
+
+export function RunOperationWithOverwrite(arg1, arg2, arg3, arg4, arg5) {
+  return window['go']['main']['App']['RunOperationWithOverwrite'](arg1, arg2, arg3, arg4, arg5);
+}
+
+export function RunPipeline(arg1, arg2, arg3) {
+  return window['go']['main']['App']['RunPipeline'](arg1, arg2, arg3);
+}
+
+export function RunPreset(arg1, arg2, arg3) {
+  return window['go']['main']['App']['RunPreset'](arg1, arg2, arg3);
+}
+
+export function SavePreset(arg1, arg2) {
+  return window['go']['main']['App']['SavePreset'](arg1, arg2);
+}
+
+export function SaveSettings(arg1) {
+  return window['go']['main']['App']['SaveSettings'](arg1);
+}
+
 export function SelectInputFile() {
   return window['go']['main']['App']['SelectInputFile']();
 }
@@ -66,14 +206,30 @@ export function SelectOutputFile(arg1) {
   return window['go']['main']['App']['SelectOutputFile'](arg1);
 }
 
-export function TrimRange(arg1, arg2, arg3, arg4) {
-  return window['go']['main']['App']['TrimRange'](arg1, arg2, arg3, arg4);
+export function SelectStreams(arg1, arg2, arg3) {
+  return window['go']['main']['App']['SelectStreams'](arg1, arg2, arg3);
+}
+
+export function SetMaxConcurrentJobs(arg1) {
+  return window['go']['main']['App']['SetMaxConcurrentJobs'](arg1);
+}
+
+export function Transcode(arg1, arg2, arg3) {
+  return window['go']['main']['App']['Transcode'](arg1, arg2, arg3);
+}
+
+export function TrimRange(arg1, arg2, arg3, arg4, arg5) {
+  return window['go']['main']['App']['TrimRange'](arg1, arg2, arg3, arg4, arg5);
+}
+
+export function TrimStart(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['TrimStart'](arg1, arg2, arg3, arg4);
 }
 
-export function TrimStart(arg1, arg2, arg3) {
-  return window['go']['main']['App']['TrimStart'](arg1, arg2, arg3);
+export function TrimToLength(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['TrimToLength'](arg1, arg2, arg3, arg4);
 }
 
-export function TrimToLength(arg1, arg2, arg3) {
-  return window['go']['main']['App']['TrimToLength'](arg1, arg2, arg3);
+export function ValidateOperation(arg1, arg2, arg3) {
+  return window['go']['main']['App']['ValidateOperation'](arg1, arg2, arg3);
 }
@@ -1,13 +1,299 @@
+export namespace ffmpeg {
+	
+	export class ParamSpec {
+	    name: string;
+	    label: string;
+	    type: string;
+	    default?: any;
+	    required: boolean;
+	    options?: string[];
+	    min?: number;
+	    max?: number;
+	    aliases?: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new ParamSpec(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.label = source["label"];
+	        this.type = source["type"];
+	        this.default = source["default"];
+	        this.required = source["required"];
+	        this.options = source["options"];
+	        this.min = source["min"];
+	        this.max = source["max"];
+	        this.aliases = source["aliases"];
+	    }
+	}
+	export class Operation {
+	    name: string;
+	    label: string;
+	    params: ParamSpec[];
+	    output_suffix: string;
+	    output_ext?: string;
+	    standalone?: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new Operation(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.label = source["label"];
+	        this.params = this.convertValues(source["params"], ParamSpec);
+	        this.output_suffix = source["output_suffix"];
+	        this.output_ext = source["output_ext"];
+	        this.standalone = source["standalone"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+}
+
 export namespace models {
 	
+	export class BatchItem {
+	    job_id: string;
+	    input: string;
+	    output: string;
+	    status: string;
+	    progress: number;
+	    error?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new BatchItem(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.job_id = source["job_id"];
+	        this.input = source["input"];
+	        this.output = source["output"];
+	        this.status = source["status"];
+	        this.progress = source["progress"];
+	        this.error = source["error"];
+	    }
+	}
+	export class BatchRef {
+	    id: string;
+	    stop_on_error: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new BatchRef(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.stop_on_error = source["stop_on_error"];
+	    }
+	}
+	export class BatchRequest {
+	    operation: string;
+	    params: Record<string, any>;
+	    inputs: string[];
+	    directory: string;
+	    pattern: string;
+	    output_dir: string;
+	    name_template: string;
+	    stop_on_error: boolean;
+	    overwrite: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new BatchRequest(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.operation = source["operation"];
+	        this.params = source["params"];
+	        this.inputs = source["inputs"];
+	        this.directory = source["directory"];
+	        this.pattern = source["pattern"];
+	        this.output_dir = source["output_dir"];
+	        this.name_template = source["name_template"];
+	        this.stop_on_error = source["stop_on_error"];
+	        this.overwrite = source["overwrite"];
+	    }
+	}
+	export class BatchSummary {
+	    id: string;
+	    operation: string;
+	    total: number;
+	    queued: number;
+	    running: number;
+	    completed: number;
+	    failed: number;
+	    cancelled: number;
+	    percent: number;
+	    done: boolean;
+	    items: BatchItem[];
+	
+	    static createFrom(source: any = {}) {
+	        return new BatchSummary(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.operation = source["operation"];
+	        this.total = source["total"];
+	        this.queued = source["queued"];
+	        this.running = source["running"];
+	        this.completed = source["completed"];
+	        this.failed = source["failed"];
+	        this.cancelled = source["cancelled"];
+	        this.percent = source["percent"];
+	        this.done = source["done"];
+	        this.items = this.convertValues(source["items"], BatchItem);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class Chapter {
+	    start: number;
+	    end: number;
+	    title: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new Chapter(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.start = source["start"];
+	        this.end = source["end"];
+	        this.title = source["title"];
+	    }
+	}
+	export class FieldError {
+	    field: string;
+	    message: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new FieldError(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.field = source["field"];
+	        this.message = source["message"];
+	    }
+	}
+	export class StreamInfo {
+	    index: number;
+	    type: string;
+	    codec: string;
+	    codec_long_name?: string;
+	    profile?: string;
+	    bitrate?: number;
+	    duration?: number;
+	    language?: string;
+	    title?: string;
+	    default: boolean;
+	    forced: boolean;
+	    attached_picture?: boolean;
+	    tags?: Record<string, string>;
+	    width?: number;
+	    height?: number;
+	    frame_rate?: number;
+	    pixel_format?: string;
+	    color_space?: string;
+	    color_transfer?: string;
+	    color_primaries?: string;
+	    color_range?: string;
+	    rotation?: number;
+	    level?: number;
+	    time_base?: string;
+	    channels?: number;
+	    channel_layout?: string;
+	    sample_rate?: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new StreamInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.index = source["index"];
+	        this.type = source["type"];
+	        this.codec = source["codec"];
+	        this.codec_long_name = source["codec_long_name"];
+	        this.profile = source["profile"];
+	        this.bitrate = source["bitrate"];
+	        this.duration = source["duration"];
+	        this.language = source["language"];
+	        this.title = source["title"];
+	        this.default = source["default"];
+	        this.forced = source["forced"];
+	        this.attached_picture = source["attached_picture"];
+	        this.tags = source["tags"];
+	        this.width = source["width"];
+	        this.height = source["height"];
+	        this.frame_rate = source["frame_rate"];
+	        this.pixel_format = source["pixel_format"];
+	        this.color_space = source["color_space"];
+	        this.color_transfer = source["color_transfer"];
+	        this.color_primaries = source["color_primaries"];
+	        this.color_range = source["color_range"];
+	        this.rotation = source["rotation"];
+	        this.level = source["level"];
+	        this.time_base = source["time_base"];
+	        this.channels = source["channels"];
+	        this.channel_layout = source["channel_layout"];
+	        this.sample_rate = source["sample_rate"];
+	    }
+	}
 	export class FileInfo {
 	    path: string;
 	    size: number;
 	    duration: number;
+	    start_time: number;
 	    format: string;
+	    bitrate: number;
+	    tags?: Record<string, string>;
 	    codec: string;
 	    width: number;
 	    height: number;
+	    streams: StreamInfo[];
+	    chapters: Chapter[];
 	
 	    static createFrom(source: any = {}) {
 	        return new FileInfo(source);
@@ -18,11 +304,205 @@ export namespace models {
 	        this.path = source["path"];
 	        this.size = source["size"];
 	        this.duration = source["duration"];
+	        this.start_time = source["start_time"];
 	        this.format = source["format"];
+	        this.bitrate = source["bitrate"];
+	        this.tags = source["tags"];
 	        this.codec = source["codec"];
 	        this.width = source["width"];
 	        this.height = source["height"];
+	        this.streams = this.convertValues(source["streams"], StreamInfo);
+	        this.chapters = this.convertValues(source["chapters"], Chapter);
 	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class HardwareEncoder {
+	    name: string;
+	    api: string;
+	    codec: string;
+	    device?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new HardwareEncoder(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.api = source["api"];
+	        this.codec = source["codec"];
+	        this.device = source["device"];
+	    }
+	}
+	export class OperationParams {
+	    operation: string;
+	    input: string;
+	    output: string;
+	    params: Record<string, any>;
+	
+	    static createFrom(source: any = {}) {
+	        return new OperationParams(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.operation = source["operation"];
+	        this.input = source["input"];
+	        this.output = source["output"];
+	        this.params = source["params"];
+	    }
+	}
+	export class HistoryEntry {
+	    id: string;
+	    operation: OperationParams;
+	    command: string;
+	    passes: string[][];
+	    files?: Record<string, string>;
+	    status: string;
+	    exit_code: number;
+	    error?: string;
+	    log?: string[];
+	    // Go type: time
+	    started_at: any;
+	    // Go type: time
+	    finished_at: any;
+	
+	    static createFrom(source: any = {}) {
+	        return new HistoryEntry(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.operation = this.convertValues(source["operation"], OperationParams);
+	        this.command = source["command"];
+	        this.passes = source["passes"];
+	        this.files = source["files"];
+	        this.status = source["status"];
+	        this.exit_code = source["exit_code"];
+	        this.error = source["error"];
+	        this.log = source["log"];
+	        this.started_at = this.convertValues(source["started_at"], null);
+	        this.finished_at = this.convertValues(source["finished_at"], null);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class HistoryQuery {
+	    operation: string;
+	    status: string;
+	    text: string;
+	    limit: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new HistoryQuery(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.operation = source["operation"];
+	        this.status = source["status"];
+	        this.text = source["text"];
+	        this.limit = source["limit"];
+	    }
+	}
+	export class Job {
+	    id: string;
+	    operation: OperationParams;
+	    passes: string[][];
+	    files?: Record<string, string>;
+	    durations: number[];
+	    output_size: number;
+	    warnings?: string[];
+	    status: string;
+	    paused?: boolean;
+	    progress: number;
+	    error?: string;
+	    exit_code: number;
+	    log?: string[];
+	    batch?: BatchRef;
+	    // Go type: time
+	    created_at: any;
+	    // Go type: time
+	    started_at?: any;
+	    // Go type: time
+	    finished_at?: any;
+	
+	    static createFrom(source: any = {}) {
+	        return new Job(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.operation = this.convertValues(source["operation"], OperationParams);
+	        this.passes = source["passes"];
+	        this.files = source["files"];
+	        this.durations = source["durations"];
+	        this.output_size = source["output_size"];
+	        this.warnings = source["warnings"];
+	        this.status = source["status"];
+	        this.paused = source["paused"];
+	        this.progress = source["progress"];
+	        this.error = source["error"];
+	        this.exit_code = source["exit_code"];
+	        this.log = source["log"];
+	        this.batch = this.convertValues(source["batch"], BatchRef);
+	        this.created_at = this.convertValues(source["created_at"], null);
+	        this.started_at = this.convertValues(source["started_at"], null);
+	        this.finished_at = this.convertValues(source["finished_at"], null);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
 	}
 	export class MountPoint {
 	    path: string;
@@ -42,6 +522,193 @@ export namespace models {
 	        this.used = source["used"];
 	    }
 	}
+	
+	export class OutputCheck {
+	    output: string;
+	    exists: boolean;
+	    job_id?: string;
+	    suggested: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new OutputCheck(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.output = source["output"];
+	        this.exists = source["exists"];
+	        this.job_id = source["job_id"];
+	        this.suggested = source["suggested"];
+	    }
+	}
+	export class PipelineStep {
+	    operation: string;
+	    params: Record<string, any>;
+	
+	    static createFrom(source: any = {}) {
+	        return new PipelineStep(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.operation = source["operation"];
+	        this.params = source["params"];
+	    }
+	}
+	export class Preset {
+	    name: string;
+	    operation: OperationParams;
+	    // Go type: time
+	    updated_at: any;
+	
+	    static createFrom(source: any = {}) {
+	        return new Preset(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.operation = this.convertValues(source["operation"], OperationParams);
+	        this.updated_at = this.convertValues(source["updated_at"], null);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class Settings {
+	    ffmpeg_path: string;
+	    ffprobe_path: string;
+	    disk_warn_mb: number;
+	    disk_stop_mb: number;
+	    disk_action: string;
+	    overwrite: string;
+	    pass_timeout_minutes: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new Settings(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.ffmpeg_path = source["ffmpeg_path"];
+	        this.ffprobe_path = source["ffprobe_path"];
+	        this.disk_warn_mb = source["disk_warn_mb"];
+	        this.disk_stop_mb = source["disk_stop_mb"];
+	        this.disk_action = source["disk_action"];
+	        this.overwrite = source["overwrite"];
+	        this.pass_timeout_minutes = source["pass_timeout_minutes"];
+	    }
+	}
+	export class SpaceCheck {
+	    output: string;
+	    mount: string;
+	    estimated: number;
+	    pending: number;
+	    available: number;
+	    fits: boolean;
+	    warning?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SpaceCheck(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.output = source["output"];
+	        this.mount = source["mount"];
+	        this.estimated = source["estimated"];
+	        this.pending = source["pending"];
+	        this.available = source["available"];
+	        this.fits = source["fits"];
+	        this.warning = source["warning"];
+	    }
+	}
+	
+	export class StreamSelection {
+	    index: number;
+	    language?: string;
+	    title?: string;
+	    default: boolean;
+	    forced: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new StreamSelection(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.index = source["index"];
+	        this.language = source["language"];
+	        this.title = source["title"];
+	        this.default = source["default"];
+	        this.forced = source["forced"];
+	    }
+	}
+	export class Toolchain {
+	    ffmpeg: string;
+	    ffmpeg_source: string;
+	    ffprobe: string;
+	    ffprobe_source: string;
+	    version: string;
+	    configuration: string[];
+	    libraries: string[];
+	    warnings?: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new Toolchain(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.ffmpeg = source["ffmpeg"];
+	        this.ffmpeg_source = source["ffmpeg_source"];
+	        this.ffprobe = source["ffprobe"];
+	        this.ffprobe_source = source["ffprobe_source"];
+	        this.version = source["version"];
+	        this.configuration = source["configuration"];
+	        this.libraries = source["libraries"];
+	        this.warnings = source["warnings"];
+	    }
+	}
+	export class TranscodeSettings {
+	    video_codec: string;
+	    crf: number;
+	    preset: string;
+	    tune: string;
+	    pix_fmt: string;
+	    audio_codec: string;
+	    audio_bitrate: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new TranscodeSettings(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.video_codec = source["video_codec"];
+	        this.crf = source["crf"];
+	        this.preset = source["preset"];
+	        this.tune = source["tune"];
+	        this.pix_fmt = source["pix_fmt"];
+	        this.audio_codec = source["audio_codec"];
+	        this.audio_bitrate = source["audio_bitrate"];
+	    }
+	}
 
 }
 
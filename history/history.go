@@ -0,0 +1,218 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"ffwd-ui/ffmpeg"
+	"ffwd-ui/models"
+)
+
+// maxEntries bounds the history file; the oldest entries are dropped first.
+const maxEntries = 500
+
+var ErrEntryNotFound = errors.New("history entry not found")
+
+// Store is the log of finished jobs, kept as one JSON object per line so
+// recording a job only appends to the file.
+type Store struct {
+	path    string
+	mu      sync.Mutex
+	entries []models.HistoryEntry
+}
+
+// NewStore loads the history saved at path. A missing file is an empty
+// history.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path}
+	if path == "" {
+		return s, nil
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var entry models.HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// Skip a line truncated by a crash rather than losing the rest.
+			continue
+		}
+		s.entries = append(s.entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return s, err
+	}
+
+	if len(s.entries) > maxEntries {
+		s.entries = s.entries[len(s.entries)-maxEntries:]
+		return s, s.rewrite()
+	}
+	return s, nil
+}
+
+// Record adds a finished job. Jobs that never started, such as queued jobs
+// that were cancelled, are ignored.
+func (s *Store) Record(job models.Job) error {
+	if job.StartedAt == nil || job.FinishedAt == nil {
+		return nil
+	}
+
+	entry := models.HistoryEntry{
+		ID:         job.ID,
+		Operation:  job.Operation,
+		Command:    ffmpeg.BuildPassesString(job.Passes),
+		Passes:     job.Passes,
+		Files:      job.Files,
+		Status:     job.Status,
+		ExitCode:   job.ExitCode,
+		Error:      job.Error,
+		Log:        job.Log,
+		StartedAt:  *job.StartedAt,
+		FinishedAt: *job.FinishedAt,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = append(s.entries, entry)
+	if len(s.entries) > maxEntries {
+		s.entries = s.entries[len(s.entries)-maxEntries:]
+		return s.rewrite()
+	}
+	return s.append(entry)
+}
+
+// Query returns the entries matching q, newest first.
+func (s *Store) Query(q models.HistoryQuery) []models.HistoryEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	text := strings.ToLower(q.Text)
+	var result []models.HistoryEntry
+
+	for i := len(s.entries) - 1; i >= 0; i-- {
+		entry := s.entries[i]
+
+		if q.Operation != "" && entry.Operation.Operation != q.Operation {
+			continue
+		}
+		if q.Status != "" && entry.Status != q.Status {
+			continue
+		}
+		if text != "" &&
+			!strings.Contains(strings.ToLower(entry.Operation.Input), text) &&
+			!strings.Contains(strings.ToLower(entry.Operation.Output), text) &&
+			!strings.Contains(strings.ToLower(entry.Command), text) {
+			continue
+		}
+
+		result = append(result, entry)
+		if q.Limit > 0 && len(result) >= q.Limit {
+			break
+		}
+	}
+
+	return result
+}
+
+func (s *Store) Get(id string) (models.HistoryEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range s.entries {
+		if entry.ID == id {
+			return entry, nil
+		}
+	}
+	return models.HistoryEntry{}, fmt.Errorf("%w: %s", ErrEntryNotFound, id)
+}
+
+// Select returns the entries with the given IDs in the order they ran.
+func (s *Store) Select(ids []string) ([]models.HistoryEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	var selected []models.HistoryEntry
+	for _, entry := range s.entries {
+		if wanted[entry.ID] {
+			selected = append(selected, entry)
+			delete(wanted, entry.ID)
+		}
+	}
+
+	for id := range wanted {
+		return nil, fmt.Errorf("%w: %s", ErrEntryNotFound, id)
+	}
+	return selected, nil
+}
+
+func (s *Store) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = nil
+	return s.rewrite()
+}
+
+// append writes one entry to the end of the file. s.mu must be held.
+func (s *Store) append(entry models.HistoryEntry) error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// rewrite replaces the file with the entries in memory. s.mu must be held.
+func (s *Store) rewrite() error {
+	if s.path == "" {
+		return nil
+	}
+
+	var buf strings.Builder
+	for _, entry := range s.entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(buf.String()), 0o644); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,112 @@
+package history
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"ffwd-ui/ffmpeg"
+	"ffwd-ui/models"
+)
+
+// ShellScript renders entries as a POSIX shell script that reruns their
+// ffmpeg commands in order, with the global options the executor uses.
+// Multi-pass commands get a temporary directory in place of
+// ffmpeg.WorkDir, as the executor would give them, and the work files they
+// read are recreated there with here-documents.
+func ShellScript(entries []models.HistoryEntry) string {
+	var b strings.Builder
+
+	b.WriteString("#!/bin/sh\n")
+	fmt.Fprintf(&b, "# Exported from ffwd-ui history on %s\n", time.Now().Format("2006-01-02 15:04"))
+	b.WriteString("set -e\n")
+
+	for _, entry := range entries {
+		b.WriteString("\n")
+		fmt.Fprintf(&b, "# %s: %s -> %s (%s, %s)\n",
+			entry.Operation.Operation,
+			oneLine(entry.Operation.Input),
+			oneLine(entry.Operation.Output),
+			entry.StartedAt.Format("2006-01-02 15:04"),
+			entry.Status)
+
+		usesWorkDir := strings.Contains(entry.Command, ffmpeg.WorkDir) || len(entry.Files) > 0
+		if usesWorkDir {
+			b.WriteString("workdir=$(mktemp -d)\n")
+		}
+
+		names := make([]string, 0, len(entry.Files))
+		for name := range entry.Files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			end := heredocEnd(entry.Files[name])
+			fmt.Fprintf(&b, "cat > \"$workdir\"/%s <<'%s'\n", shellQuote(name), end)
+			b.WriteString(entry.Files[name])
+			if !strings.HasSuffix(entry.Files[name], "\n") {
+				b.WriteString("\n")
+			}
+			b.WriteString(end + "\n")
+		}
+
+		for _, args := range entry.Passes {
+			b.WriteString("ffmpeg")
+			for _, arg := range append(ffmpeg.GlobalArgs(), args...) {
+				b.WriteString(" ")
+				b.WriteString(shellArg(arg))
+			}
+			b.WriteString("\n")
+		}
+
+		if usesWorkDir {
+			b.WriteString("rm -rf \"$workdir\"\n")
+		}
+	}
+
+	return b.String()
+}
+
+// heredocEnd returns a terminator for a here-document holding content: the
+// first of FFWD_EOF, FFWD_EOF_1, ... that is not a line of it.
+func heredocEnd(content string) string {
+	lines := make(map[string]bool)
+	for _, line := range strings.Split(content, "\n") {
+		lines[line] = true
+	}
+
+	end := "FFWD_EOF"
+	for i := 1; lines[end]; i++ {
+		end = fmt.Sprintf("FFWD_EOF_%d", i)
+	}
+	return end
+}
+
+// shellArg quotes arg for a POSIX shell, substituting "$workdir" for
+// ffmpeg.WorkDir.
+func shellArg(arg string) string {
+	if arg == "" {
+		return "''"
+	}
+
+	parts := strings.Split(arg, ffmpeg.WorkDir)
+	for i, part := range parts {
+		parts[i] = shellQuote(part)
+	}
+	return strings.Join(parts, "\"$workdir\"")
+}
+
+func shellQuote(s string) string {
+	if s == "" {
+		return ""
+	}
+	if !strings.ContainsAny(s, " \t\n'\"\\()[]{}$&|;<>~`#*?!") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", "'\\''") + "'"
+}
+
+func oneLine(s string) string {
+	return strings.NewReplacer("\n", " ", "\r", " ").Replace(s)
+}
@@ -0,0 +1,105 @@
+package history
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"ffwd-ui/ffmpeg"
+	"ffwd-ui/models"
+)
+
+func TestShellArg(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want string
+	}{
+		{"", "''"},
+		{"out.mp4", "out.mp4"},
+		{"my video.mp4", "'my video.mp4'"},
+		{"it's.mp4", `'it'\''s.mp4'`},
+		{"$HOME", "'$HOME'"},
+		{"wow!.mp4", "'wow!.mp4'"},
+		{ffmpeg.WorkDir + "/passlog", `"$workdir"/passlog`},
+		{"file:" + ffmpeg.WorkDir + "/a b.txt", `file:"$workdir"'/a b.txt'`},
+	}
+	for _, tt := range tests {
+		if got := shellArg(tt.arg); got != tt.want {
+			t.Errorf("shellArg(%q) = %s, want %s", tt.arg, got, tt.want)
+		}
+	}
+}
+
+func TestHeredocEnd(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"file 'a.mp4'\n", "FFWD_EOF"},
+		{"FFWD_EOF\n", "FFWD_EOF_1"},
+		{"FFWD_EOF\nFFWD_EOF_1", "FFWD_EOF_2"},
+		{"  FFWD_EOF\nFFWD_EOF_x", "FFWD_EOF"},
+	}
+	for _, tt := range tests {
+		if got := heredocEnd(tt.content); got != tt.want {
+			t.Errorf("heredocEnd(%q) = %s, want %s", tt.content, got, tt.want)
+		}
+	}
+}
+
+// TestShellScript runs an exported script with a stand-in ffmpeg that
+// prints its arguments and its input, to check that the arguments reach
+// it unchanged and that the work files are recreated as they were.
+func TestShellScript(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+
+	bin := t.TempDir()
+	fake := `#!/bin/sh
+for arg; do
+	printf '%s\n' "$arg"
+	[ "$prev" = -i ] && input=$arg
+	prev=$arg
+done
+cat "$input"
+`
+	if err := os.WriteFile(filepath.Join(bin, "ffmpeg"), []byte(fake), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	list := "file 'it''s.mp4'\nFFWD_EOF\n$HOME `date`"
+	entry := models.HistoryEntry{
+		Operation: models.OperationParams{Operation: "concat", Input: "it's.mp4", Output: "out put.mp4"},
+		Passes:    [][]string{{"-f", "concat", "-i", ffmpeg.WorkDir + "/list.txt", "-c", "copy", "out put.mp4"}},
+		Files:     map[string]string{"list.txt": list},
+	}
+
+	cmd := exec.Command("sh", "-c", ShellScript([]models.HistoryEntry{entry}))
+	cmd.Env = append(os.Environ(), "PATH="+bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("script failed: %v\n%s", err, out)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	args := append(ffmpeg.GlobalArgs(), entry.Passes[0]...)
+	if len(lines) != len(args)+3 {
+		t.Fatalf("got output\n%s\nwant %d arguments and the 3 lines of list.txt", out, len(args))
+	}
+	for i, arg := range args {
+		if arg == ffmpeg.WorkDir+"/list.txt" {
+			if !strings.HasSuffix(lines[i], "/list.txt") || strings.Contains(lines[i], ffmpeg.WorkDir) {
+				t.Errorf("argument %d is %q, want the list in the work directory", i, lines[i])
+			}
+		} else if lines[i] != arg {
+			t.Errorf("argument %d is %q, want %q", i, lines[i], arg)
+		}
+	}
+	if got := strings.Join(lines[len(args):], "\n"); got != list {
+		t.Errorf("list.txt is %q, want %q", got, list)
+	}
+}
@@ -0,0 +1,123 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"ffwd-ui/models"
+)
+
+var ErrBatchNotFound = errors.New("batch not found")
+
+// EnqueueBatch adds one job per task as a batch and returns its ID. With
+// stopOnError, the first job of the batch to fail cancels the others;
+// otherwise failed files are skipped and the rest still run.
+func (q *Queue) EnqueueBatch(tasks []Task, stopOnError bool) (string, error) {
+	if len(tasks) == 0 {
+		return "", fmt.Errorf("batch has no files")
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		return "", err
+	}
+	ref := models.BatchRef{ID: id, StopOnError: stopOnError}
+
+	batch := make([]*models.Job, len(tasks))
+	for i, task := range tasks {
+		job, err := newJob(task)
+		if err != nil {
+			return "", err
+		}
+		job.Batch = &ref
+		batch[i] = job
+	}
+
+	q.mu.Lock()
+	q.jobs = append(q.jobs, batch...)
+	changed := q.schedule()
+	q.mu.Unlock()
+
+	q.notify(changed)
+	return id, nil
+}
+
+// Batch summarises the jobs of a batch that are still in the list.
+func (q *Queue) Batch(id string) (models.BatchSummary, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	summary := models.BatchSummary{ID: id}
+	var progress float64
+
+	for _, job := range q.jobs {
+		if job.Batch == nil || job.Batch.ID != id {
+			continue
+		}
+
+		summary.Operation = job.Operation.Operation
+		summary.Items = append(summary.Items, models.BatchItem{
+			JobID:    job.ID,
+			Input:    job.Operation.Input,
+			Output:   job.Operation.Output,
+			Status:   job.Status,
+			Progress: job.Progress,
+			Error:    job.Error,
+		})
+
+		switch job.Status {
+		case models.JobQueued:
+			summary.Queued++
+		case models.JobRunning:
+			summary.Running++
+			progress += job.Progress
+		case models.JobCompleted:
+			summary.Completed++
+		case models.JobFailed:
+			summary.Failed++
+		case models.JobCancelled:
+			summary.Cancelled++
+		}
+	}
+
+	summary.Total = len(summary.Items)
+	if summary.Total == 0 {
+		return summary, fmt.Errorf("%w: %s", ErrBatchNotFound, id)
+	}
+
+	finished := summary.Completed + summary.Failed + summary.Cancelled
+	summary.Percent = (float64(finished)*100 + progress) / float64(summary.Total)
+	summary.Done = summary.Queued == 0 && summary.Running == 0
+	return summary, nil
+}
+
+// stopBatchLocked cancels the other unfinished jobs in failed's batch when
+// the batch stops on error, and returns the queued jobs it cancelled.
+// Running jobs report their cancellation through the executor. q.mu must
+// be held.
+func (q *Queue) stopBatchLocked(failed *models.Job) []models.Job {
+	if failed.Batch == nil || !failed.Batch.StopOnError {
+		return nil
+	}
+
+	reason := fmt.Errorf("batch stopped after %s failed", filepath.Base(failed.Operation.Input))
+
+	var cancelled []models.Job
+	for _, job := range q.jobs {
+		if job == failed || job.Batch == nil || job.Batch.ID != failed.Batch.ID {
+			continue
+		}
+
+		switch job.Status {
+		case models.JobQueued:
+			q.finishLocked(job, models.JobCancelled, reason)
+			cancelled = append(cancelled, *job)
+		case models.JobRunning:
+			if executor := q.executors[job.ID]; executor != nil {
+				executor.Cancel()
+			}
+		}
+	}
+	return cancelled
+}
@@ -0,0 +1,548 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"ffwd-ui/ffmpeg"
+	"ffwd-ui/models"
+)
+
+const defaultConcurrency = 1
+
+var ErrJobNotFound = errors.New("job not found")
+
+// Queue runs ffmpeg jobs with a bounded number of concurrent executors.
+// Jobs that have not finished are persisted to statePath so they can be
+// resumed after a restart.
+type Queue struct {
+	ctx         context.Context
+	statePath   string
+	mu          sync.Mutex
+	jobs        []*models.Job
+	executors   map[string]*ffmpeg.Executor
+	concurrency int
+	onStart     func(models.Job)
+	onProgress  func(models.ProgressUpdate)
+	onComplete  func(models.Job)
+	onError     func(models.Job)
+	onDisk      func(models.DiskAlert)
+	diskPolicy  DiskPolicy
+	passTimeout time.Duration
+	running     sync.WaitGroup
+}
+
+type queueState struct {
+	Concurrency int           `json:"concurrency"`
+	Jobs        []*models.Job `json:"jobs"`
+}
+
+func NewQueue(ctx context.Context, statePath string) *Queue {
+	return &Queue{
+		ctx:         ctx,
+		statePath:   statePath,
+		executors:   make(map[string]*ffmpeg.Executor),
+		concurrency: defaultConcurrency,
+		diskPolicy:  DefaultDiskPolicy,
+		passTimeout: ffmpeg.DefaultPassTimeout,
+	}
+}
+
+func (q *Queue) SetStartCallback(cb func(models.Job)) {
+	q.onStart = cb
+}
+
+func (q *Queue) SetProgressCallback(cb func(models.ProgressUpdate)) {
+	q.onProgress = cb
+}
+
+func (q *Queue) SetCompleteCallback(cb func(models.Job)) {
+	q.onComplete = cb
+}
+
+func (q *Queue) SetErrorCallback(cb func(models.Job)) {
+	q.onError = cb
+}
+
+// Load restores the jobs persisted by a previous run and starts them.
+// Jobs that were running when the app exited are queued again from the
+// beginning.
+func (q *Queue) Load() error {
+	if q.statePath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(q.statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read queue state: %w", err)
+	}
+
+	var state queueState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to parse queue state: %w", err)
+	}
+
+	q.mu.Lock()
+	if state.Concurrency > 0 {
+		q.concurrency = state.Concurrency
+	}
+	for _, job := range state.Jobs {
+		if job.Status != models.JobQueued && job.Status != models.JobRunning {
+			continue
+		}
+		requeue(job)
+		q.jobs = append(q.jobs, job)
+	}
+	changed := q.schedule()
+	q.mu.Unlock()
+
+	q.notify(changed)
+	return nil
+}
+
+// Task is the work for one job: an operation and the ffmpeg passes that
+// implement it. Files are created in the job's work directory first.
+// Durations holds the output length in seconds of each pass and is used to
+// compute progress. OutputSize is the estimated size of the output in
+// bytes, and Warnings are shown with the job.
+type Task struct {
+	Operation  models.OperationParams
+	Passes     [][]string
+	Files      map[string]string
+	Durations  []float64
+	OutputSize int64
+	Warnings   []string
+}
+
+// Enqueue adds a job running task.
+func (q *Queue) Enqueue(task Task) (models.Job, error) {
+	job, err := newJob(task)
+	if err != nil {
+		return models.Job{}, err
+	}
+
+	q.mu.Lock()
+	q.jobs = append(q.jobs, job)
+	changed := q.schedule()
+	snapshot := *job
+	q.mu.Unlock()
+
+	q.notify(changed)
+	return snapshot, nil
+}
+
+// Cancel stops a running job or removes a queued one from the schedule.
+func (q *Queue) Cancel(id string) error {
+	q.mu.Lock()
+
+	job := q.find(id)
+	if job == nil {
+		q.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+
+	switch job.Status {
+	case models.JobRunning:
+		executor := q.executors[id]
+		q.mu.Unlock()
+		return executor.Cancel()
+	case models.JobQueued:
+		q.finishLocked(job, models.JobCancelled, ffmpeg.ErrCancelled)
+		snapshot := *job
+		q.persist()
+		q.mu.Unlock()
+
+		if q.onError != nil {
+			q.onError(snapshot)
+		}
+		return nil
+	default:
+		q.mu.Unlock()
+		return fmt.Errorf("job %s is already %s", id, job.Status)
+	}
+}
+
+// CancelAll cancels every queued and running job.
+func (q *Queue) CancelAll() {
+	for _, job := range q.Jobs() {
+		if job.Status == models.JobQueued || job.Status == models.JobRunning {
+			q.Cancel(job.ID)
+		}
+	}
+}
+
+// Jobs returns a snapshot of all jobs in submission order.
+func (q *Queue) Jobs() []models.Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := make([]models.Job, len(q.jobs))
+	for i, job := range q.jobs {
+		jobs[i] = *job
+	}
+	return jobs
+}
+
+func (q *Queue) Job(id string) (models.Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job := q.find(id)
+	if job == nil {
+		return models.Job{}, false
+	}
+	return *job, true
+}
+
+// ClearFinished drops completed, failed and cancelled jobs from the list.
+func (q *Queue) ClearFinished() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pending := q.jobs[:0]
+	for _, job := range q.jobs {
+		if job.Status == models.JobQueued || job.Status == models.JobRunning {
+			pending = append(pending, job)
+		}
+	}
+	q.jobs = pending
+}
+
+func (q *Queue) Concurrency() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.concurrency
+}
+
+// SetConcurrency changes how many jobs may run at once. Lowering the limit
+// does not stop jobs that are already running.
+func (q *Queue) SetConcurrency(n int) error {
+	if n < 1 {
+		return fmt.Errorf("concurrency must be at least 1")
+	}
+
+	q.mu.Lock()
+	q.concurrency = n
+	changed := q.schedule()
+	q.persist()
+	q.mu.Unlock()
+
+	q.notify(changed)
+	return nil
+}
+
+// schedule starts queued jobs until the concurrency limit is reached and
+// returns the jobs it started or failed to start, and saves the queue.
+// Nothing is started once the queue's context is cancelled. q.mu must be
+// held.
+func (q *Queue) schedule() []models.Job {
+	var changed []models.Job
+
+	for _, job := range q.jobs {
+		if len(q.executors) >= q.concurrency || q.ctx.Err() != nil {
+			break
+		}
+		if job.Status != models.JobQueued {
+			continue
+		}
+
+		executor := q.newExecutor(job.ID)
+		executor.SetWorkFiles(job.Files)
+		executor.SetOutput(job.Operation.Output)
+		executor.SetPassTimeout(q.passTimeout)
+		if op, err := ffmpeg.LookupOperation(job.Operation.Operation); err == nil {
+			if op.Retry != nil {
+				executor.SetVerify(q.retry(job.ID, op))
+			}
+			if op.Fallback != nil {
+				executor.SetFallback(q.fallback(job.ID, op))
+			}
+		}
+		if err := executor.ExecutePasses(job.Passes, job.Durations); err != nil {
+			q.finishLocked(job, models.JobFailed, err)
+			changed = append(changed, *job)
+			changed = append(changed, q.stopBatchLocked(job)...)
+			continue
+		}
+
+		now := time.Now()
+		job.Status = models.JobRunning
+		job.StartedAt = &now
+		q.executors[job.ID] = executor
+		q.running.Add(1)
+		go q.watchDisk(job.ID, job.Operation.Output, executor)
+		changed = append(changed, *job)
+	}
+
+	q.persist()
+	return changed
+}
+
+// SetPassTimeout sets the limit on each ffmpeg invocation of the jobs
+// started from now on; see Executor.SetPassTimeout.
+func (q *Queue) SetPassTimeout(timeout time.Duration) {
+	q.mu.Lock()
+	q.passTimeout = timeout
+	q.mu.Unlock()
+}
+
+func (q *Queue) newExecutor(id string) *ffmpeg.Executor {
+	executor := ffmpeg.NewExecutor(q.ctx)
+
+	executor.SetProgressCallback(func(update models.ProgressUpdate) {
+		update.JobID = id
+
+		q.mu.Lock()
+		if job := q.find(id); job != nil {
+			job.Progress = update.Percent
+		}
+		q.mu.Unlock()
+
+		if q.onProgress != nil {
+			q.onProgress(update)
+		}
+	})
+
+	executor.SetCompleteCallback(func() {
+		q.finish(id, nil)
+	})
+
+	executor.SetErrorCallback(func(err error) {
+		q.finish(id, err)
+	})
+
+	return executor
+}
+
+// retry returns the check for Executor.SetVerify that asks op whether job
+// id must run again, and records the adjusted parameters and passes in the
+// job when it must.
+func (q *Queue) retry(id string, op *ffmpeg.Operation) func(attempt int) ([][]string, []float64, error) {
+	return func(attempt int) ([][]string, []float64, error) {
+		q.mu.Lock()
+		job := q.find(id)
+		if job == nil {
+			q.mu.Unlock()
+			return nil, nil, nil
+		}
+		request := job.Operation
+		durations := job.Durations
+		q.mu.Unlock()
+
+		params, passes, err := op.RetryPasses(request.Input, request.Output, ffmpeg.Params(request.Params), attempt)
+		if err != nil || len(passes) == 0 {
+			return nil, nil, err
+		}
+
+		q.mu.Lock()
+		job.Operation.Params = params
+		job.Passes = passes
+		q.persist()
+		q.mu.Unlock()
+
+		return passes, durations, nil
+	}
+}
+
+// fallback returns the function for Executor.SetFallback that asks op for
+// a software command after job's passes failed, and records it in the job.
+func (q *Queue) fallback(id string, op *ffmpeg.Operation) func() ([][]string, []float64) {
+	return func() ([][]string, []float64) {
+		q.mu.Lock()
+		job := q.find(id)
+		if job == nil {
+			q.mu.Unlock()
+			return nil, nil
+		}
+		request := job.Operation
+		durations := job.Durations
+		q.mu.Unlock()
+
+		params, passes := op.FallbackPasses(request.Input, request.Output, ffmpeg.Params(request.Params))
+		if len(passes) == 0 {
+			return nil, nil
+		}
+
+		q.mu.Lock()
+		job.Operation.Params = params
+		job.Passes = passes
+		q.persist()
+		q.mu.Unlock()
+
+		return passes, durations
+	}
+}
+
+func (q *Queue) finish(id string, err error) {
+	q.mu.Lock()
+
+	job := q.find(id)
+	if job == nil {
+		q.mu.Unlock()
+		return
+	}
+
+	executor := q.executors[id]
+	if executor != nil {
+		job.Log = executor.StderrTail()
+		delete(q.executors, id)
+		defer q.running.Done()
+	}
+
+	// A job stopped because the queue's context was cancelled, as when
+	// the server shuts down, was interrupted rather than cancelled. It is
+	// saved as queued so that Load runs it again.
+	if q.ctx.Err() != nil && errors.Is(err, ffmpeg.ErrCancelled) {
+		requeue(job)
+		q.persist()
+		q.mu.Unlock()
+		return
+	}
+
+	status := models.JobCompleted
+	if errors.Is(err, ffmpeg.ErrCancelled) {
+		status = models.JobCancelled
+	} else if err != nil {
+		status = models.JobFailed
+	}
+	q.finishLocked(job, status, err)
+
+	var stopped []models.Job
+	if status == models.JobFailed {
+		stopped = q.stopBatchLocked(job)
+	}
+
+	snapshot := *job
+	changed := append(stopped, q.schedule()...)
+	q.mu.Unlock()
+
+	if err == nil {
+		if q.onComplete != nil {
+			q.onComplete(snapshot)
+		}
+	} else if q.onError != nil {
+		q.onError(snapshot)
+	}
+
+	q.notify(changed)
+}
+
+// Wait blocks until the jobs that are running have finished. After the
+// queue's context is cancelled, that is until the interrupted jobs are
+// saved to be run again.
+func (q *Queue) Wait() {
+	q.running.Wait()
+}
+
+// requeue resets a job that did not finish to run from the beginning.
+func requeue(job *models.Job) {
+	job.Status = models.JobQueued
+	job.Paused = false
+	job.Progress = 0
+	job.StartedAt = nil
+}
+
+func (q *Queue) finishLocked(job *models.Job, status models.JobStatus, err error) {
+	now := time.Now()
+	job.Status = status
+	job.Paused = false
+	job.FinishedAt = &now
+	if status == models.JobCompleted {
+		job.Progress = 100
+	}
+	if err != nil {
+		job.Error = err.Error()
+		job.ExitCode = -1
+
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			job.ExitCode = exitErr.ExitCode()
+		}
+	}
+}
+
+// notify reports the jobs returned by schedule to the start and error
+// callbacks.
+func (q *Queue) notify(changed []models.Job) {
+	for _, job := range changed {
+		if job.Status == models.JobRunning {
+			if q.onStart != nil {
+				q.onStart(job)
+			}
+		} else if q.onError != nil {
+			q.onError(job)
+		}
+	}
+}
+
+func (q *Queue) find(id string) *models.Job {
+	for _, job := range q.jobs {
+		if job.ID == id {
+			return job
+		}
+	}
+	return nil
+}
+
+// persist writes the unfinished jobs to disk. q.mu must be held.
+func (q *Queue) persist() {
+	if q.statePath == "" {
+		return
+	}
+
+	state := queueState{Concurrency: q.concurrency}
+	for _, job := range q.jobs {
+		if job.Status == models.JobQueued || job.Status == models.JobRunning {
+			state.Jobs = append(state.Jobs, job)
+		}
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return
+	}
+
+	tmp := q.statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return
+	}
+	os.Rename(tmp, q.statePath)
+}
+
+func newJob(task Task) (*models.Job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Job{
+		ID:         id,
+		Operation:  task.Operation,
+		Passes:     task.Passes,
+		Files:      task.Files,
+		Durations:  task.Durations,
+		OutputSize: task.OutputSize,
+		Warnings:   task.Warnings,
+		Status:     models.JobQueued,
+		CreatedAt:  time.Now(),
+	}, nil
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate job id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,107 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"ffwd-ui/models"
+)
+
+// stoppedQueue returns a queue saving to statePath whose context is
+// already cancelled, so that it keeps its jobs queued instead of running
+// them.
+func stoppedQueue(statePath string) *Queue {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return NewQueue(ctx, statePath)
+}
+
+func TestQueueSaveLoad(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "queue.json")
+
+	q := stoppedQueue(statePath)
+	if err := q.SetConcurrency(3); err != nil {
+		t.Fatal(err)
+	}
+	tasks := []Task{
+		{
+			Operation:  models.OperationParams{Operation: "convert_format", Input: "a.mp4", Output: "a.mkv"},
+			Passes:     [][]string{{"-i", "a.mp4", "-c", "copy", "a.mkv"}},
+			Durations:  []float64{10},
+			OutputSize: 1000,
+		},
+		{
+			Operation: models.OperationParams{Operation: "concat", Input: "b.mp4", Output: "c.mp4"},
+			Passes:    [][]string{{"-f", "concat", "-i", "{workdir}/list.txt", "-c", "copy", "c.mp4"}},
+			Files:     map[string]string{"list.txt": "file 'b.mp4'\n"},
+			Durations: []float64{20},
+			Warnings:  []string{"c.mp4 needs about 2 MB"},
+		},
+	}
+	for _, task := range tasks {
+		if _, err := q.Enqueue(task); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loaded := stoppedQueue(statePath)
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.Concurrency(); got != 3 {
+		t.Errorf("concurrency is %d, want 3", got)
+	}
+	// The jobs are compared as saved, since times lose their monotonic
+	// clock reading on the way.
+	got, _ := json.Marshal(loaded.Jobs())
+	want, _ := json.Marshal(q.Jobs())
+	if string(got) != string(want) {
+		t.Errorf("loaded jobs\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestQueueLoadRequeues(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "queue.json")
+	started := time.Now()
+	state := queueState{Jobs: []*models.Job{
+		{ID: "queued", Status: models.JobQueued},
+		{ID: "running", Status: models.JobRunning, Progress: 40, Paused: true, StartedAt: &started},
+		{ID: "completed", Status: models.JobCompleted},
+		{ID: "failed", Status: models.JobFailed},
+	}}
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(statePath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	q := stoppedQueue(statePath)
+	if err := q.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []models.Job{
+		{ID: "queued", Status: models.JobQueued},
+		{ID: "running", Status: models.JobQueued},
+	}
+	if got := q.Jobs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded jobs\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestQueueLoadMissing(t *testing.T) {
+	q := stoppedQueue(filepath.Join(t.TempDir(), "queue.json"))
+	if err := q.Load(); err != nil {
+		t.Fatalf("Load without a saved queue: %v", err)
+	}
+	if jobs := q.Jobs(); len(jobs) != 0 {
+		t.Errorf("loaded %d jobs, want none", len(jobs))
+	}
+}
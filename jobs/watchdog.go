@@ -0,0 +1,166 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"ffwd-ui/ffmpeg"
+	"ffwd-ui/models"
+	"ffwd-ui/system"
+)
+
+// Disk watchdog actions, as reported in models.DiskAlert.
+const (
+	DiskWarn   = "warn"
+	DiskPause  = "pause"
+	DiskResume = "resume"
+	DiskCancel = "cancel"
+)
+
+// DiskPolicy decides what the watchdog does while a job runs. Every
+// Interval it reads the free space of the disk the output is written to.
+// Below WarnBelow bytes it warns once; below StopBelow it pauses the job,
+// or cancels it when Action is DiskCancel or pausing is not supported. A
+// paused job resumes once the free space is back above WarnBelow.
+type DiskPolicy struct {
+	WarnBelow uint64
+	StopBelow uint64
+	Action    string
+	Interval  time.Duration
+}
+
+// DefaultDiskPolicy warns below 2 GB and pauses below 500 MB, checking
+// every five seconds.
+var DefaultDiskPolicy = DiskPolicy{
+	WarnBelow: 2000 * 1000 * 1000,
+	StopBelow: 500 * 1000 * 1000,
+	Action:    DiskPause,
+	Interval:  5 * time.Second,
+}
+
+// Validate checks that the watchdog can follow the policy: it needs an
+// interval to poll at, and StopBelow must be under WarnBelow, or jobs
+// would be stopped without ever being warned about.
+func (p DiskPolicy) Validate() error {
+	var fields []models.FieldError
+	if p.Interval <= 0 {
+		fields = append(fields, models.FieldError{Field: "interval", Message: "must be greater than zero"})
+	}
+	if p.StopBelow >= p.WarnBelow {
+		fields = append(fields, models.FieldError{Field: "stop_below", Message: fmt.Sprintf("must be less than the warning threshold of %d bytes", p.WarnBelow)})
+	}
+	if len(fields) > 0 {
+		return &ffmpeg.ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// SetDiskPolicy changes the policy of the disk watchdog, including for the
+// jobs already running. A policy that fails Validate is refused.
+func (q *Queue) SetDiskPolicy(policy DiskPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	q.mu.Lock()
+	q.diskPolicy = policy
+	q.mu.Unlock()
+	return nil
+}
+
+// DiskPolicy returns the policy of the disk watchdog.
+func (q *Queue) DiskPolicy() DiskPolicy {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.diskPolicy
+}
+
+// SetDiskCallback sets the function that receives the watchdog's alerts.
+func (q *Queue) SetDiskCallback(cb func(models.DiskAlert)) {
+	q.onDisk = cb
+}
+
+// watchDisk polls the free space of the directory output is written to
+// while executor runs job id, and acts on it according to the disk policy.
+func (q *Queue) watchDisk(id, output string, executor *ffmpeg.Executor) {
+	dir := filepath.Dir(output)
+	warned, paused := false, false
+
+	for {
+		q.mu.Lock()
+		policy := q.diskPolicy
+		q.mu.Unlock()
+
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-time.After(policy.Interval):
+		}
+
+		q.mu.Lock()
+		running := q.executors[id] == executor
+		q.mu.Unlock()
+		if !running {
+			return
+		}
+
+		space, err := system.GetDiskSpace(dir)
+		if err != nil {
+			continue
+		}
+		available := space.Available
+		free := system.FormatBytes(int64(available))
+
+		switch {
+		case available < policy.StopBelow:
+			if paused {
+				continue
+			}
+			if policy.Action != DiskCancel {
+				err := executor.Pause()
+				if err == nil {
+					paused = true
+					q.setPaused(id, true)
+					q.alert(id, DiskPause, dir, available, fmt.Sprintf("Only %s free on the disk of %s; the job is paused until space is freed", free, dir))
+					continue
+				}
+				if !errors.Is(err, ffmpeg.ErrPauseUnsupported) {
+					continue
+				}
+			}
+			reason := fmt.Sprintf("stopped with only %s free on the disk of %s, before it filled up", free, dir)
+			if executor.CancelWithReason(reason) == nil {
+				q.alert(id, DiskCancel, dir, available, "The job was "+reason)
+			}
+			return
+		case paused && available >= policy.WarnBelow:
+			if executor.Resume() == nil {
+				paused, warned = false, false
+				q.setPaused(id, false)
+				q.alert(id, DiskResume, dir, available, fmt.Sprintf("%s free on the disk of %s again; the job has resumed", free, dir))
+			}
+		case available < policy.WarnBelow:
+			if !warned && !paused {
+				warned = true
+				q.alert(id, DiskWarn, dir, available, fmt.Sprintf("Only %s free on the disk of %s", free, dir))
+			}
+		default:
+			warned = false
+		}
+	}
+}
+
+func (q *Queue) setPaused(id string, paused bool) {
+	q.mu.Lock()
+	if job := q.find(id); job != nil {
+		job.Paused = paused
+	}
+	q.mu.Unlock()
+}
+
+func (q *Queue) alert(id, action, path string, available uint64, message string) {
+	if q.onDisk != nil {
+		q.onDisk(models.DiskAlert{JobID: id, Action: action, Path: path, Available: available, Message: message})
+	}
+}
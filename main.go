@@ -2,6 +2,7 @@ package main
 
 import (
 	"embed"
+	"os"
 
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
@@ -16,6 +17,10 @@ var assets embed.FS
 var icon []byte
 
 func main() {
+	if isCLICommand(os.Args[1:]) {
+		os.Exit(runCLI(os.Args[1:]))
+	}
+
 	app := NewApp()
 
 	err := wails.Run(&options.App{
@@ -1,13 +1,177 @@
 package models
 
+import "time"
+
+// FileInfo describes a media file. Codec, Width and Height are those of the
+// main video stream; Streams lists every stream in the file.
 type FileInfo struct {
-	Path     string  `json:"path"`
-	Size     int64   `json:"size"`
-	Duration float64 `json:"duration"`
-	Format   string  `json:"format"`
-	Codec    string  `json:"codec"`
-	Width    int     `json:"width"`
-	Height   int     `json:"height"`
+	Path      string            `json:"path"`
+	Size      int64             `json:"size"`
+	Duration  float64           `json:"duration"`
+	StartTime float64           `json:"start_time"` // timestamp of the first frame
+	Format    string            `json:"format"`
+	Bitrate   int64             `json:"bitrate"` // bit/s, 0 when unknown
+	Tags      map[string]string `json:"tags,omitempty"`
+	Codec     string            `json:"codec"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Streams   []StreamInfo      `json:"streams"`
+	Chapters  []Chapter         `json:"chapters"`
+}
+
+// Chapter is a chapter marker. Times are in seconds; an End of zero means
+// the chapter runs until the next one starts.
+type Chapter struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Title string  `json:"title"`
+}
+
+// StreamInfo describes one stream of a media file. Type is ffprobe's codec
+// type: video, audio, subtitle, data or attachment. Fields that do not apply
+// to the stream's type are left zero.
+type StreamInfo struct {
+	Index           int               `json:"index"`
+	Type            string            `json:"type"`
+	Codec           string            `json:"codec"`
+	CodecLongName   string            `json:"codec_long_name,omitempty"`
+	Profile         string            `json:"profile,omitempty"`
+	Bitrate         int64             `json:"bitrate,omitempty"` // bit/s
+	Duration        float64           `json:"duration,omitempty"`
+	Language        string            `json:"language,omitempty"`
+	Title           string            `json:"title,omitempty"`
+	Default         bool              `json:"default"`
+	Forced          bool              `json:"forced"`
+	AttachedPicture bool              `json:"attached_picture,omitempty"` // cover art
+	Tags            map[string]string `json:"tags,omitempty"`
+
+	Width          int     `json:"width,omitempty"`
+	Height         int     `json:"height,omitempty"`
+	FrameRate      float64 `json:"frame_rate,omitempty"`
+	PixelFormat    string  `json:"pixel_format,omitempty"`
+	ColorSpace     string  `json:"color_space,omitempty"`
+	ColorTransfer  string  `json:"color_transfer,omitempty"`
+	ColorPrimaries string  `json:"color_primaries,omitempty"`
+	ColorRange     string  `json:"color_range,omitempty"`
+	Rotation       int     `json:"rotation,omitempty"`  // degrees clockwise
+	Level          int     `json:"level,omitempty"`     // as ffprobe reports it, 0 when unknown
+	TimeBase       string  `json:"time_base,omitempty"` // such as "1/15360"
+
+	Channels      int    `json:"channels,omitempty"`
+	ChannelLayout string `json:"channel_layout,omitempty"`
+	SampleRate    int    `json:"sample_rate,omitempty"`
+}
+
+// StreamSelection picks one input stream for the output of the
+// select_streams operation. Index is the stream's index in the input, as in
+// StreamInfo.Index. An empty Language or Title keeps the input's tag.
+type StreamSelection struct {
+	Index    int    `json:"index"`
+	Language string `json:"language,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Default  bool   `json:"default"`
+	Forced   bool   `json:"forced"`
+}
+
+// TranscodeSettings are the encoder settings of the transcode operation.
+// VideoCodec and AudioCodec are ffmpeg encoder names, or "copy" or "none";
+// AudioCodec may also be "auto". A CRF of -1 and empty strings leave the
+// encoder's defaults.
+type TranscodeSettings struct {
+	VideoCodec   string `json:"video_codec"`
+	CRF          int    `json:"crf"`
+	Preset       string `json:"preset"`
+	Tune         string `json:"tune"`
+	PixelFormat  string `json:"pix_fmt"`
+	AudioCodec   string `json:"audio_codec"`
+	AudioBitrate string `json:"audio_bitrate"`
+}
+
+// HardwareEncoder is a hardware video encoder that completed a test
+// encode. API is the acceleration API (nvenc, qsv, vaapi, videotoolbox, amf
+// or v4l2m2m), Codec the codec it produces (h264, hevc or av1) and Device
+// the device it was opened on, for APIs that need one.
+type HardwareEncoder struct {
+	Name   string `json:"name"`
+	API    string `json:"api"`
+	Codec  string `json:"codec"`
+	Device string `json:"device,omitempty"`
+}
+
+// Toolchain describes the ffmpeg and ffprobe binaries in use. The sources
+// say where each was found: settings, environment, bundled (next to the
+// executable), path or missing. Configuration holds the configure options
+// of the ffmpeg build and Libraries the external libraries they enable.
+type Toolchain struct {
+	FFmpeg        string   `json:"ffmpeg"`
+	FFmpegSource  string   `json:"ffmpeg_source"`
+	FFprobe       string   `json:"ffprobe"`
+	FFprobeSource string   `json:"ffprobe_source"`
+	Version       string   `json:"version"`
+	Configuration []string `json:"configuration"`
+	Libraries     []string `json:"libraries"`
+	Warnings      []string `json:"warnings,omitempty"`
+}
+
+// Settings are the user's preferences. An empty FFmpegPath or FFprobePath
+// looks the binary up instead (see ffmpeg.LocateToolchain). The disk
+// settings control the watchdog of running jobs: below DiskWarnMB of free
+// space on an output's disk it warns, and below DiskStopMB it takes
+// DiskAction, "pause" or "cancel". Overwrite is what happens to an output
+// that already exists: "ask", "overwrite" or "rename". PassTimeoutMinutes
+// stops an ffmpeg invocation that runs for longer. Zero values use the
+// defaults, which allow each invocation 30 minutes.
+type Settings struct {
+	FFmpegPath         string `json:"ffmpeg_path"`
+	FFprobePath        string `json:"ffprobe_path"`
+	DiskWarnMB         int    `json:"disk_warn_mb"`
+	DiskStopMB         int    `json:"disk_stop_mb"`
+	DiskAction         string `json:"disk_action"`
+	Overwrite          string `json:"overwrite"`
+	PassTimeoutMinutes int    `json:"pass_timeout_minutes"`
+}
+
+// DiskAlert reports what the disk watchdog did about a running job. Action
+// is warn, pause, resume or cancel, and Available the free bytes on the
+// disk of the job's output, whose directory is Path.
+type DiskAlert struct {
+	JobID     string `json:"job_id"`
+	Action    string `json:"action"`
+	Path      string `json:"path"`
+	Available uint64 `json:"available"`
+	Message   string `json:"message"`
+}
+
+// SpaceCheck compares the estimated size of an output with the free space
+// of the mount it is written to. Pending is what the queued and running
+// jobs writing to the same mount are expected to take. Warning is set
+// when the output fits with little to spare.
+type SpaceCheck struct {
+	Output    string `json:"output"`
+	Mount     string `json:"mount"`
+	Estimated int64  `json:"estimated"`
+	Pending   int64  `json:"pending"`
+	Available uint64 `json:"available"`
+	Fits      bool   `json:"fits"`
+	Warning   string `json:"warning,omitempty"`
+}
+
+// FieldError is a problem with one parameter of an operation, for showing
+// next to its input. Field is empty for problems with the request as a
+// whole, such as an input without video.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// OutputCheck tells whether an output path is already taken, either by a
+// file or by a queued or running job, whose ID is then JobID. Suggested is
+// the free name the rename policy would write to instead.
+type OutputCheck struct {
+	Output    string `json:"output"`
+	Exists    bool   `json:"exists"`
+	JobID     string `json:"job_id,omitempty"`
+	Suggested string `json:"suggested"`
 }
 
 type MountPoint struct {
@@ -24,7 +188,131 @@ type OperationParams struct {
 	Params    map[string]interface{} `json:"params"`
 }
 
+// PipelineStep is one operation of a pipeline. Its input is the previous
+// step's output.
+type PipelineStep struct {
+	Operation string                 `json:"operation"`
+	Params    map[string]interface{} `json:"params"`
+}
+
 type ProgressUpdate struct {
-	Percent float64 `json:"percent"`
-	Message string  `json:"message"`
+	JobID     string  `json:"job_id,omitempty"`
+	Percent   float64 `json:"percent"`
+	Message   string  `json:"message"`
+	Frame     int64   `json:"frame"`
+	FPS       float64 `json:"fps"`
+	Speed     float64 `json:"speed"`
+	OutTime   float64 `json:"out_time"` // seconds
+	TotalSize int64   `json:"total_size"`
+	Bitrate   float64 `json:"bitrate"` // kbit/s
+	ETA       float64 `json:"eta"`     // seconds, 0 when unknown
+}
+
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobCompleted JobStatus = "completed"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+type Job struct {
+	ID         string            `json:"id"`
+	Operation  OperationParams   `json:"operation"`
+	Passes     [][]string        `json:"passes"`
+	Files      map[string]string `json:"files,omitempty"` // created in the work directory
+	Durations  []float64         `json:"durations"`       // output seconds per pass
+	OutputSize int64             `json:"output_size"`     // estimated bytes
+	Warnings   []string          `json:"warnings,omitempty"`
+	Status     JobStatus         `json:"status"`
+	Paused     bool              `json:"paused,omitempty"` // running but suspended, see DiskAlert
+	Progress   float64           `json:"progress"`
+	Error      string            `json:"error,omitempty"`
+	ExitCode   int               `json:"exit_code"`
+	Log        []string          `json:"log,omitempty"`
+	Batch      *BatchRef         `json:"batch,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+	StartedAt  *time.Time        `json:"started_at,omitempty"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+}
+
+// BatchRef links a job to the batch it was queued with.
+type BatchRef struct {
+	ID          string `json:"id"`
+	StopOnError bool   `json:"stop_on_error"`
+}
+
+// BatchRequest runs one operation on many files. Inputs lists the files
+// explicitly; otherwise every file in Directory matching Pattern is used.
+// NameTemplate builds each output file name from the placeholders {name}
+// (input name without extension), {ext} (output extension including the
+// dot), {default} (the name GetDefaultOutputName suggests) and {index}.
+// Outputs go to OutputDir, or next to their input when it is empty.
+// Overwrite is the policy for outputs that already exist, the one in the
+// settings when empty.
+type BatchRequest struct {
+	Operation    string                 `json:"operation"`
+	Params       map[string]interface{} `json:"params"`
+	Inputs       []string               `json:"inputs"`
+	Directory    string                 `json:"directory"`
+	Pattern      string                 `json:"pattern"`
+	OutputDir    string                 `json:"output_dir"`
+	NameTemplate string                 `json:"name_template"`
+	StopOnError  bool                   `json:"stop_on_error"`
+	Overwrite    string                 `json:"overwrite"`
+}
+
+type BatchItem struct {
+	JobID    string    `json:"job_id"`
+	Input    string    `json:"input"`
+	Output   string    `json:"output"`
+	Status   JobStatus `json:"status"`
+	Progress float64   `json:"progress"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// BatchSummary reports the state of every file in a batch. Percent is the
+// share of the batch that has been processed, counting finished files in
+// full whatever their outcome.
+type BatchSummary struct {
+	ID        string      `json:"id"`
+	Operation string      `json:"operation"`
+	Total     int         `json:"total"`
+	Queued    int         `json:"queued"`
+	Running   int         `json:"running"`
+	Completed int         `json:"completed"`
+	Failed    int         `json:"failed"`
+	Cancelled int         `json:"cancelled"`
+	Percent   float64     `json:"percent"`
+	Done      bool        `json:"done"`
+	Items     []BatchItem `json:"items"`
+}
+
+type Preset struct {
+	Name      string          `json:"name"`
+	Operation OperationParams `json:"operation"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+type HistoryEntry struct {
+	ID         string            `json:"id"`
+	Operation  OperationParams   `json:"operation"`
+	Command    string            `json:"command"`
+	Passes     [][]string        `json:"passes"`
+	Files      map[string]string `json:"files,omitempty"`
+	Status     JobStatus         `json:"status"`
+	ExitCode   int               `json:"exit_code"`
+	Error      string            `json:"error,omitempty"`
+	Log        []string          `json:"log,omitempty"`
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt time.Time         `json:"finished_at"`
+}
+
+type HistoryQuery struct {
+	Operation string    `json:"operation"`
+	Status    JobStatus `json:"status"`
+	Text      string    `json:"text"`
+	Limit     int       `json:"limit"`
 }
@@ -0,0 +1,263 @@
+package presets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ffwd-ui/ffmpeg"
+	"ffwd-ui/models"
+)
+
+var ErrPresetNotFound = errors.New("preset not found")
+
+// Store keeps named operation presets in a JSON file. Presets only carry the
+// operation and its parameters; input and output paths are not saved.
+type Store struct {
+	path    string
+	mu      sync.Mutex
+	presets map[string]models.Preset
+}
+
+// NewStore loads the presets saved at path. A missing file is an empty
+// store.
+func NewStore(path string) (*Store, error) {
+	s := &Store{
+		path:    path,
+		presets: make(map[string]models.Preset),
+	}
+
+	presets, err := readPresets(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+
+	for _, preset := range presets {
+		s.presets[preset.Name] = preset
+	}
+	return s, nil
+}
+
+// List returns all presets sorted by name.
+func (s *Store) List() []models.Preset {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sorted(nil)
+}
+
+func (s *Store) Get(name string) (models.Preset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	preset, ok := s.presets[name]
+	if !ok {
+		return models.Preset{}, fmt.Errorf("%w: %s", ErrPresetNotFound, name)
+	}
+	return preset, nil
+}
+
+// Save validates op and stores it under name, replacing any preset with the
+// same name.
+func (s *Store) Save(name string, op models.OperationParams) (models.Preset, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return models.Preset{}, fmt.Errorf("preset name is required")
+	}
+
+	params, err := Validate(op)
+	if err != nil {
+		return models.Preset{}, err
+	}
+
+	preset := models.Preset{
+		Name: name,
+		Operation: models.OperationParams{
+			Operation: op.Operation,
+			Params:    params,
+		},
+		UpdatedAt: time.Now(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.presets[name] = preset
+	return preset, s.write()
+}
+
+func (s *Store) Rename(oldName, newName string) error {
+	newName = strings.TrimSpace(newName)
+	if newName == "" {
+		return fmt.Errorf("preset name is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	preset, ok := s.presets[oldName]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrPresetNotFound, oldName)
+	}
+	if oldName == newName {
+		return nil
+	}
+	if _, exists := s.presets[newName]; exists {
+		return fmt.Errorf("a preset named %q already exists", newName)
+	}
+
+	delete(s.presets, oldName)
+	preset.Name = newName
+	preset.UpdatedAt = time.Now()
+	s.presets[newName] = preset
+	return s.write()
+}
+
+func (s *Store) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.presets[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrPresetNotFound, name)
+	}
+
+	delete(s.presets, name)
+	return s.write()
+}
+
+// Import adds the presets from a file written by Export, replacing presets
+// with the same name. Every preset is validated before any is added. It
+// returns the number of presets imported.
+func (s *Store) Import(path string) (int, error) {
+	presets, err := readPresets(path)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, preset := range presets {
+		if strings.TrimSpace(preset.Name) == "" {
+			return 0, fmt.Errorf("preset %d has no name", i+1)
+		}
+		params, err := Validate(preset.Operation)
+		if err != nil {
+			return 0, fmt.Errorf("preset %q: %w", preset.Name, err)
+		}
+		presets[i].Operation = models.OperationParams{
+			Operation: preset.Operation.Operation,
+			Params:    params,
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, preset := range presets {
+		preset.UpdatedAt = now
+		s.presets[preset.Name] = preset
+	}
+	return len(presets), s.write()
+}
+
+// Export writes the named presets, or all presets when names is empty, to
+// path.
+func (s *Store) Export(path string, names []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, name := range names {
+		if _, ok := s.presets[name]; !ok {
+			return fmt.Errorf("%w: %s", ErrPresetNotFound, name)
+		}
+	}
+
+	return writePresets(path, s.sorted(names))
+}
+
+// Validate checks op against the registered operation's parameters and
+// returns the resolved parameters. Unlike Operation.Resolve it rejects
+// parameters the operation does not declare, which usually means the
+// preset was saved for a different version of the operation.
+func Validate(op models.OperationParams) (ffmpeg.Params, error) {
+	operation, err := ffmpeg.LookupOperation(op.Operation)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool, len(operation.Params))
+	for _, spec := range operation.Params {
+		known[spec.Name] = true
+	}
+	for name := range op.Params {
+		if !known[name] {
+			return nil, fmt.Errorf("%s: unknown parameter %q", op.Operation, name)
+		}
+	}
+
+	return operation.Resolve(op.Params)
+}
+
+// sorted returns the named presets, or all of them when names is empty,
+// ordered by name. s.mu must be held.
+func (s *Store) sorted(names []string) []models.Preset {
+	var presets []models.Preset
+	if len(names) == 0 {
+		for _, preset := range s.presets {
+			presets = append(presets, preset)
+		}
+	} else {
+		for _, name := range names {
+			presets = append(presets, s.presets[name])
+		}
+	}
+
+	sort.Slice(presets, func(i, j int) bool {
+		return strings.ToLower(presets[i].Name) < strings.ToLower(presets[j].Name)
+	})
+	return presets
+}
+
+// write saves the store to disk. s.mu must be held.
+func (s *Store) write() error {
+	if s.path == "" {
+		return nil
+	}
+	return writePresets(s.path, s.sorted(nil))
+}
+
+func readPresets(path string) ([]models.Preset, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var presets []models.Preset
+	if err := json.Unmarshal(data, &presets); err != nil {
+		return nil, fmt.Errorf("failed to parse presets: %w", err)
+	}
+	return presets, nil
+}
+
+func writePresets(path string, presets []models.Preset) error {
+	if presets == nil {
+		presets = []models.Preset{}
+	}
+
+	data, err := json.MarshalIndent(presets, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write presets: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"ffwd-ui/ffmpeg"
+	"ffwd-ui/jobs"
+	"ffwd-ui/models"
+)
+
+const defaultServerAddr = "127.0.0.1:7465"
+
+// runServeCommand starts the local HTTP API and blocks until ctx is
+// cancelled.
+func runServeCommand(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := flags.String("addr", defaultServerAddr, "address to listen on (loopback only)")
+	token := flags.String("token", os.Getenv("FFWD_API_TOKEN"), "require this bearer token on every request (default $FFWD_API_TOKEN)")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	host, _, err := net.SplitHostPort(*addr)
+	if err != nil || !isLoopbackHost(host) {
+		fmt.Fprintf(os.Stderr, "Error: %s is not a loopback address\n", *addr)
+		return exitUsage
+	}
+
+	broker := newEventBroker()
+	app := NewApp()
+	if err := app.start(ctx, broker.publish, "server-queue.json"); err != nil {
+		log.Printf("startup: %v", err)
+	}
+
+	server := &http.Server{
+		Addr:    *addr,
+		Handler: newAPIHandler(app, broker, *token),
+	}
+
+	// The cancelled context also stops the running jobs, which the queue
+	// keeps as queued for the next start.
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("ffwd-ui API listening on http://%s", *addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailed
+	}
+	app.queue.Wait()
+	return exitOK
+}
+
+// newAPIHandler exposes the App operations over HTTP:
+//
+//	GET  /api/operations        operation schemas
+//	GET  /api/hardware          working hardware encoders (?refresh=1 to probe again)
+//	GET  /api/toolchain         ffmpeg build in use
+//	GET  /api/probe?path=...    file information
+//	GET  /api/keyframes?path=.. keyframe times of the main video stream
+//	POST /api/preview           ffmpeg command for an operation
+//	POST /api/validate          field-level problems with an operation's parameters
+//	GET  /api/output?path=...   whether an output is taken, and a free name
+//	GET  /api/jobs              all jobs
+//	POST /api/jobs              queue an operation
+//	GET  /api/jobs/{id}         one job
+//	POST /api/jobs/{id}/cancel  cancel a job
+//	POST /api/batches           queue an operation for many files
+//	GET  /api/batches/{id}      batch summary
+//	GET  /api/events            job events as Server-Sent Events
+//
+// Operation requests use the models.OperationParams JSON shape, with an
+// optional "overwrite" policy, and batch requests the models.BatchRequest
+// shape. A request refused because its output exists gets 409 Conflict,
+// and one with invalid parameters 422 with the problems listed per field.
+func newAPIHandler(app *App, broker *eventBroker, token string) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/operations", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, app.GetOperations())
+	})
+
+	mux.HandleFunc("GET /api/hardware", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, app.GetHardwareEncoders(r.URL.Query().Get("refresh") != ""))
+	})
+
+	mux.HandleFunc("GET /api/toolchain", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, app.GetToolchain())
+	})
+
+	mux.HandleFunc("GET /api/probe", func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Query().Get("path")
+		if path == "" {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("missing path"))
+			return
+		}
+		info, err := app.GetFileInfo(path)
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, info)
+	})
+
+	mux.HandleFunc("GET /api/keyframes", func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Query().Get("path")
+		if path == "" {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("missing path"))
+			return
+		}
+		keyframes, err := app.GetKeyframes(path)
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, keyframes)
+	})
+
+	mux.HandleFunc("POST /api/preview", func(w http.ResponseWriter, r *http.Request) {
+		var req models.OperationParams
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		command, err := app.PreviewCommand(req.Operation, req.Input, req.Output, req.Params)
+		if err != nil {
+			writeError(w, errorStatus(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"command": command})
+	})
+
+	mux.HandleFunc("POST /api/validate", func(w http.ResponseWriter, r *http.Request) {
+		var req models.OperationParams
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		fields := app.ValidateOperation(req.Operation, req.Input, req.Params)
+		if fields == nil {
+			fields = []models.FieldError{}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"fields": fields})
+	})
+
+	mux.HandleFunc("GET /api/output", func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Query().Get("path")
+		if path == "" {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("missing path"))
+			return
+		}
+		writeJSON(w, http.StatusOK, app.CheckOutput(path))
+	})
+
+	mux.HandleFunc("GET /api/jobs", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, app.ListJobs())
+	})
+
+	mux.HandleFunc("POST /api/jobs", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			models.OperationParams
+			Overwrite string `json:"overwrite"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		id, err := app.RunOperationWithOverwrite(req.Operation, req.Input, req.Output, req.Params, req.Overwrite)
+		if err != nil {
+			writeError(w, errorStatus(err), err)
+			return
+		}
+		job, _ := app.GetJob(id)
+		writeJSON(w, http.StatusCreated, job)
+	})
+
+	mux.HandleFunc("GET /api/jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		job, err := app.GetJob(r.PathValue("id"))
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	})
+
+	mux.HandleFunc("POST /api/jobs/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		if err := app.CancelJob(r.PathValue("id")); err != nil {
+			status := http.StatusConflict
+			if errors.Is(err, jobs.ErrJobNotFound) {
+				status = http.StatusNotFound
+			}
+			writeError(w, status, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("POST /api/batches", func(w http.ResponseWriter, r *http.Request) {
+		var req models.BatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		summary, err := app.RunBatch(req)
+		if err != nil {
+			writeError(w, errorStatus(err), err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, summary)
+	})
+
+	mux.HandleFunc("GET /api/batches/{id}", func(w http.ResponseWriter, r *http.Request) {
+		summary, err := app.GetBatch(r.PathValue("id"))
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, summary)
+	})
+
+	mux.HandleFunc("GET /api/events", func(w http.ResponseWriter, r *http.Request) {
+		serveEvents(w, r, broker)
+	})
+
+	return guardLocal(mux, token)
+}
+
+// guardLocal rejects requests that did not come from a local client. The
+// Host check defeats DNS rebinding and the Origin check stops web pages open
+// in a browser from driving the API.
+func guardLocal(next http.Handler, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if !isLoopbackHost(host) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("host %q not allowed", r.Host))
+			return
+		}
+
+		if origin := r.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			if err != nil || !isLoopbackHost(u.Hostname()) {
+				writeError(w, http.StatusForbidden, fmt.Errorf("origin %q not allowed", origin))
+				return
+			}
+		}
+
+		if token != "" {
+			expected := "Bearer " + token
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(expected)) != 1 {
+				writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid token"))
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func serveEvents(w http.ResponseWriter, r *http.Request, broker *eventBroker) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming not supported"))
+		return
+	}
+
+	jobFilter := r.URL.Query().Get("job")
+	events := broker.subscribe()
+	defer broker.unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case event := <-events:
+			if jobFilter != "" && event.jobID != jobFilter {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.name, event.data)
+			flusher.Flush()
+		}
+	}
+}
+
+type serverEvent struct {
+	name  string
+	jobID string
+	data  []byte
+}
+
+// eventBroker fans App events out to every connected SSE client. Slow
+// clients miss events rather than blocking the job queue.
+type eventBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan serverEvent]struct{}
+}
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{
+		subscribers: make(map[chan serverEvent]struct{}),
+	}
+}
+
+func (b *eventBroker) subscribe() chan serverEvent {
+	ch := make(chan serverEvent, 64)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *eventBroker) unsubscribe(ch chan serverEvent) {
+	b.mu.Lock()
+	delete(b.subscribers, ch)
+	b.mu.Unlock()
+}
+
+func (b *eventBroker) publish(name string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+
+	event := serverEvent{name: name, data: payload}
+	switch v := data.(type) {
+	case models.Job:
+		event.jobID = v.ID
+	case models.ProgressUpdate:
+		event.jobID = v.JobID
+	case models.DiskAlert:
+		event.jobID = v.JobID
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// errorStatus returns the status for an operation request that failed
+// with err.
+func errorStatus(err error) int {
+	var validation *ffmpeg.ValidationError
+	switch {
+	case errors.Is(err, ErrOutputExists):
+		return http.StatusConflict
+	case errors.As(err, &validation):
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusBadRequest
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError reports err as {"error": message}, adding "fields" with the
+// field-level problems of a validation error.
+func writeError(w http.ResponseWriter, status int, err error) {
+	body := map[string]interface{}{"error": err.Error()}
+	var validation *ffmpeg.ValidationError
+	if errors.As(err, &validation) {
+		body["fields"] = validation.Fields
+	}
+	writeJSON(w, status, body)
+}
@@ -0,0 +1,22 @@
+package system
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// ConfigDir returns the per-user directory ffwd-ui keeps its state in,
+// creating it on first use.
+func ConfigDir() (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(base, "ffwd-ui")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	return dir, nil
+}
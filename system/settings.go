@@ -0,0 +1,47 @@
+package system
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"ffwd-ui/models"
+)
+
+// settingsFile is the name of the settings file in ConfigDir.
+const settingsFile = "settings.json"
+
+// LoadSettings reads the settings saved in the config directory. Missing
+// settings are the zero value.
+func LoadSettings() (models.Settings, error) {
+	var settings models.Settings
+
+	dir, err := ConfigDir()
+	if err != nil {
+		return settings, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, settingsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return settings, nil
+	}
+	if err != nil {
+		return settings, err
+	}
+	return settings, json.Unmarshal(data, &settings)
+}
+
+// SaveSettings writes settings to the config directory.
+func SaveSettings(settings models.Settings) error {
+	dir, err := ConfigDir()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, settingsFile), data, 0o644)
+}
@@ -0,0 +1,58 @@
+package system
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"ffwd-ui/models"
+)
+
+// MountFor returns the mount in mounts that path is on: the one with the
+// longest path that contains it. Relative paths are made absolute first.
+func MountFor(path string, mounts []models.MountPoint) (models.MountPoint, bool) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	var found models.MountPoint
+	ok := false
+	for _, mount := range mounts {
+		if !within(path, mount.Path) {
+			continue
+		}
+		if !ok || len(mount.Path) > len(found.Path) {
+			found, ok = mount, true
+		}
+	}
+	return found, ok
+}
+
+// within reports whether path is dir or inside it. On Windows paths
+// compare without regard to case.
+func within(path, dir string) bool {
+	dir = filepath.Clean(dir)
+	if len(path) < len(dir) {
+		return false
+	}
+	if prefix := path[:len(dir)]; prefix != dir && !(runtime.GOOS == "windows" && strings.EqualFold(prefix, dir)) {
+		return false
+	}
+	return len(path) == len(dir) || strings.HasSuffix(dir, string(filepath.Separator)) || path[len(dir)] == filepath.Separator
+}
+
+// FormatBytes formats a size in decimal units, as file managers show free
+// space.
+func FormatBytes(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, exp := float64(n)/unit, 0
+	for value >= unit && exp < 4 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", value, "kMGTP"[exp])
+}